@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+)
+
+// command is a CLI subcommand run instead of the tray app, e.g. `pr-monitor export`.
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"export", "[-o file]", "Write ignored/muted PRs, rechecks and state as JSON", runExport},
+	{"import", "[-mode merge|replace] file", "Restore state written by export", runImport},
+	{"doctor", "", "Check config, tokens and repo access and report problems", runDoctor},
+	{"webhook-replay", "-event type payload.json...", "Send saved webhook payloads to the running listener", runWebhookReplay},
+	{"preview", "[-no-pager] [-no-color] owner/repo#123", "Show a PR's description, reviews and diff", runPreview},
+	{"review", "[-m message] approve|request-changes|comment owner/repo#123", "Submit a review", runReview},
+	{"reassign", "owner/repo#123 login|org/team", "Hand a review to someone else and withdraw your request", runReassign},
+	{"nudge", "[-m message] owner/repo#123", "Ask the author of a PR with new commits to re-request review", runNudge},
+	{"git-credential", "get", "Git credential helper for review checkouts (used by git, not by hand)", runGitCredential},
+}
+
+func runCommand(args []string) int {
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage()
+		return 0
+	}
+
+	for _, c := range commands {
+		if c.name == name {
+			if err := c.run(args[1:]); err != nil {
+				fmt.Fprintf(os.Stderr, "pr-monitor %s: %v\n", name, err)
+				return 1
+			}
+			return 0
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "pr-monitor: unknown command %q\n\n", name)
+	printUsage()
+	return 2
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: pr-monitor [command]")
+	fmt.Fprintln(os.Stderr, "\nWith no command, runs the system tray app.\n\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-40s %s\n", c.name+" "+c.args, c.summary)
+	}
+}
+
+// openDBForCommand opens the database for a CLI command. The config is loaded
+// if present so triage sync keeps working, but commands that only touch local
+// state don't require a valid config.
+func openDBForCommand() error {
+	if err := loadConfig(); err != nil {
+		config = Config{}
+	}
+
+	if err := openDB(); err != nil {
+		return fmt.Errorf("opening database: %w", err)
+	}
+
+	initSync()
+	return nil
+}
+
+// openClientsForCommand loads the config, opens the database and sets up the
+// GitHub clients for a command that talks to GitHub. Only warnings and errors
+// are logged, to stderr.
+func openClientsForCommand() error {
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn})))
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	if len(tokenNames()) == 0 {
+		return fmt.Errorf("no GitHub tokens configured")
+	}
+	if err := openDB(); err != nil {
+		return fmt.Errorf("opening database: %w", err)
+	}
+
+	// Rechecks after an action can mute a PR, which is published to other devices
+	initSync()
+	initClients()
+	return nil
+}
@@ -4,108 +4,167 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"log"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
 
 	_ "modernc.org/sqlite"
 )
 
-var db *sql.DB
+// PRStore persists PRs, triage flags and poller state. sqliteStore is the
+// real implementation; the poller only talks to the interface so it can be
+// driven against a throwaway store in tests.
+type PRStore interface {
+	SavePR(pr PRInfo) error
+	RemovePR(repo string, number int) error
+	ReplaceRepoPRs(repo string, repoPRs []PRInfo) error
+	LoadActivePRs() ([]PRInfo, error)
+
+	IgnorePR(repo string, number int) error
+	ClearIgnored() error
+	IsIgnored(repo string, number int) bool
+	IgnoredCount() int
+	MutePR(repo string, number int) error
+	UnmutePR(repo string, number int) error
+	ClearMuted() error
+	IsMuted(repo string, number int) bool
+	MutedCount() int
+	PRReason(repo string, number int) string
+	SetFollowUp(repo string, number int, followUp bool) error
+	IsFollowUp(repo string, number int) bool
+	UpdateReviewThreads(repo string, number int, author string, threads []reviewThread) (bool, error)
+
+	GetState(key string) string
+	SetState(key, value string) error
+	StateWithPrefix(prefix string) map[string]string
+
+	ThreadProcessed(id string, updatedAt time.Time) bool
+	MarkThreadProcessed(id string, updatedAt time.Time) error
+	PruneProcessedThreads(before time.Time) error
+
+	CachedResponse(key string) (cachedResponse, bool)
+	SaveCachedResponse(key string, r cachedResponse, now time.Time) error
+	TouchCachedResponse(key string, now time.Time) error
+	PruneHTTPCache(before time.Time) error
+
+	AddRecheck(repo string, number int, startedAt time.Time) error
+	RemoveRecheck(repo string, number int) error
+	LoadRechecks() ([]recheckEntry, error)
+
+	RecordAction(a prAction) error
+	LatestAction(repo string, number int) (prAction, bool)
+
+	ApplyTriageEvent(e triageEvent) (bool, error)
+	SaveTriageState(e triageEvent) error
+	Export() (exportDoc, error)
+	Import(doc exportDoc, replace bool) error
+
+	Close() error
+}
+
+var store PRStore
+
+type sqliteStore struct {
+	db   *sql.DB
+	path string
+}
 
 func openDB() error {
-	dbPath := filepath.Join(configDir, "pr-monitor.db")
+	s, err := openSQLiteStore(filepath.Join(configDir, "pr-monitor.db"))
+	if err != nil {
+		return err
+	}
+	store = writeErrorCounter{s}
+	return nil
+}
 
-	var err error
-	db, err = sql.Open("sqlite", dbPath)
+func openSQLiteStore(path string) (*sqliteStore, error) {
+	// busy_timeout lets concurrent writers (refresh, rechecks, notifications)
+	// wait for each other's transactions instead of failing with SQLITE_BUSY.
+	// Transactions take the write lock up front, so one that reads before it
+	// writes waits too rather than failing when it upgrades.
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_txlock=immediate")
 	if err != nil {
-		return fmt.Errorf("opening database: %w", err)
+		return nil, fmt.Errorf("opening database: %w", err)
 	}
+	s := &sqliteStore{db: db, path: path}
 
 	// WAL mode for better concurrent read performance
 	if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
-		return fmt.Errorf("setting WAL mode: %w", err)
+		db.Close()
+		return nil, fmt.Errorf("setting WAL mode: %w", err)
 	}
 
-	if err := runMigrations(); err != nil {
-		return fmt.Errorf("running migrations: %w", err)
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("running migrations: %w", err)
 	}
 
-	return nil
+	return s, nil
 }
 
-func runMigrations() error {
-	_, err := db.Exec(`
-		CREATE TABLE IF NOT EXISTS prs (
-			repo TEXT NOT NULL,
-			number INTEGER NOT NULL,
-			title TEXT NOT NULL,
-			author TEXT NOT NULL,
-			url TEXT NOT NULL,
-			needs_review INTEGER NOT NULL DEFAULT 0,
-			needs_reapproval INTEGER NOT NULL DEFAULT 0,
-			ignored INTEGER NOT NULL DEFAULT 0,
-			last_checked TEXT NOT NULL,
-			PRIMARY KEY (repo, number)
-		);
-
-		CREATE TABLE IF NOT EXISTS state (
-			key TEXT PRIMARY KEY,
-			value TEXT NOT NULL
-		);
-
-		CREATE TABLE IF NOT EXISTS rechecks (
-			repo TEXT NOT NULL,
-			number INTEGER NOT NULL,
-			started_at TEXT NOT NULL,
-			PRIMARY KEY (repo, number)
-		);
-	`)
-	if err != nil {
-		return err
-	}
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
 
-	// Add muted column if it doesn't exist
-	_, err = db.Exec(`ALTER TABLE prs ADD COLUMN muted INTEGER NOT NULL DEFAULT 0`)
-	if err != nil && !strings.Contains(err.Error(), "duplicate column") {
-		return err
-	}
+// dbExecer is satisfied by both *sql.DB and *sql.Tx so writes can be shared
+// between standalone calls and transactions.
+type dbExecer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
 
-	return nil
+func (s *sqliteStore) SavePR(pr PRInfo) error {
+	return savePR(s.db, pr)
 }
 
-func dbSavePR(pr PRInfo) error {
-	_, err := db.Exec(`
-		INSERT INTO prs (repo, number, title, author, url, needs_review, needs_reapproval, ignored, last_checked)
-		VALUES (?, ?, ?, ?, ?, ?, ?, 0, ?)
+func savePR(ex dbExecer, pr PRInfo) error {
+	_, err := ex.Exec(`
+		INSERT INTO prs (repo, number, title, author, url, needs_review, needs_reapproval, follow_up, reason, ignored, last_checked)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 0, ?)
 		ON CONFLICT (repo, number) DO UPDATE SET
 			title = excluded.title,
 			author = excluded.author,
 			url = excluded.url,
 			needs_review = excluded.needs_review,
 			needs_reapproval = excluded.needs_reapproval,
+			follow_up = excluded.follow_up,
+			reason = excluded.reason,
 			last_checked = excluded.last_checked
 	`, pr.Repo, pr.Number, pr.Title, pr.Author, pr.URL,
-		boolToInt(pr.NeedsReview), boolToInt(pr.NeedsReapproval),
+		boolToInt(pr.NeedsReview), boolToInt(pr.NeedsReapproval), boolToInt(pr.FollowUp), pr.Reason,
 		time.Now().Format(time.RFC3339))
 	return err
 }
 
-func dbRemovePR(repo string, number int) error {
-	_, err := db.Exec("DELETE FROM prs WHERE repo = ? AND number = ?", repo, number)
+func (s *sqliteStore) RemovePR(repo string, number int) error {
+	_, err := s.db.Exec("DELETE FROM prs WHERE repo = ? AND number = ?", repo, number)
 	return err
 }
 
-func dbRemoveRepoActivePRs(repo string) error {
-	_, err := db.Exec("DELETE FROM prs WHERE repo = ? AND ignored = 0 AND muted = 0", repo)
-	return err
+// ReplaceRepoPRs atomically replaces the active (not ignored or muted) PRs
+// for a repo with the given set.
+func (s *sqliteStore) ReplaceRepoPRs(repo string, repoPRs []PRInfo) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM prs WHERE repo = ? AND ignored = 0 AND muted = 0", repo); err != nil {
+		return err
+	}
+	for _, pr := range repoPRs {
+		if err := savePR(tx, pr); err != nil {
+			return fmt.Errorf("saving %s: %w", pr.Key(), err)
+		}
+	}
+
+	return tx.Commit()
 }
 
-func dbLoadActivePRs() ([]PRInfo, error) {
-	rows, err := db.Query(`
-		SELECT repo, number, title, author, url, needs_review, needs_reapproval
+func (s *sqliteStore) LoadActivePRs() ([]PRInfo, error) {
+	rows, err := s.db.Query(`
+		SELECT repo, number, title, author, url, needs_review, needs_reapproval, follow_up, reason
 		FROM prs WHERE ignored = 0 AND muted = 0
 		ORDER BY repo, number
 	`)
@@ -117,105 +176,225 @@ func dbLoadActivePRs() ([]PRInfo, error) {
 	var result []PRInfo
 	for rows.Next() {
 		var pr PRInfo
-		var needsReview, needsReapproval int
+		var needsReview, needsReapproval, followUp int
 		if err := rows.Scan(&pr.Repo, &pr.Number, &pr.Title, &pr.Author, &pr.URL,
-			&needsReview, &needsReapproval); err != nil {
+			&needsReview, &needsReapproval, &followUp, &pr.Reason); err != nil {
 			return nil, err
 		}
 		pr.NeedsReview = needsReview != 0
 		pr.NeedsReapproval = needsReapproval != 0
+		pr.FollowUp = followUp != 0
 		result = append(result, pr)
 	}
 	return result, rows.Err()
 }
 
-func dbIgnorePR(repo string, number int) error {
-	_, err := db.Exec(`
-		INSERT INTO prs (repo, number, title, author, url, ignored, last_checked)
-		VALUES (?, ?, '', '', '', 1, ?)
-		ON CONFLICT (repo, number) DO UPDATE SET ignored = 1
-	`, repo, number, time.Now().Format(time.RFC3339))
-	return err
+func (s *sqliteStore) IgnorePR(repo string, number int) error {
+	if err := setIgnored(s.db, repo, number, true); err != nil {
+		return err
+	}
+	recordTriage(triageIgnore, repo, number)
+	return nil
 }
 
-func dbClearIgnored() error {
-	_, err := db.Exec("DELETE FROM prs WHERE ignored = 1")
-	return err
+func (s *sqliteStore) ClearIgnored() error {
+	keys, err := s.flaggedPRs("ignored")
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.Exec("DELETE FROM prs WHERE ignored = 1"); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		recordTriage(triageUnignore, k.repo, k.number)
+	}
+	return nil
 }
 
-func dbIsIgnored(repo string, number int) bool {
+func (s *sqliteStore) IsIgnored(repo string, number int) bool {
 	var ignored int
-	err := db.QueryRow("SELECT ignored FROM prs WHERE repo = ? AND number = ?", repo, number).Scan(&ignored)
+	err := s.db.QueryRow("SELECT ignored FROM prs WHERE repo = ? AND number = ?", repo, number).Scan(&ignored)
 	if err != nil {
 		return false
 	}
 	return ignored != 0
 }
 
-func dbIgnoredCount() int {
+func (s *sqliteStore) IgnoredCount() int {
 	var count int
-	db.QueryRow("SELECT COUNT(*) FROM prs WHERE ignored = 1").Scan(&count)
+	s.db.QueryRow("SELECT COUNT(*) FROM prs WHERE ignored = 1").Scan(&count)
 	return count
 }
 
-func dbMutePR(repo string, number int) error {
-	_, err := db.Exec(`
-		INSERT INTO prs (repo, number, title, author, url, muted, last_checked)
-		VALUES (?, ?, '', '', '', 1, ?)
-		ON CONFLICT (repo, number) DO UPDATE SET muted = 1
-	`, repo, number, time.Now().Format(time.RFC3339))
-	return err
+func (s *sqliteStore) MutePR(repo string, number int) error {
+	if err := setMuted(s.db, repo, number, true); err != nil {
+		return err
+	}
+	recordTriage(triageMute, repo, number)
+	return nil
 }
 
-func dbUnmutePR(repo string, number int) error {
-	_, err := db.Exec("UPDATE prs SET muted = 0 WHERE repo = ? AND number = ?", repo, number)
-	return err
+func (s *sqliteStore) UnmutePR(repo string, number int) error {
+	if err := setMuted(s.db, repo, number, false); err != nil {
+		return err
+	}
+	recordTriage(triageUnmute, repo, number)
+	return nil
 }
 
-func dbIsMuted(repo string, number int) bool {
+func (s *sqliteStore) IsMuted(repo string, number int) bool {
 	var muted int
-	err := db.QueryRow("SELECT muted FROM prs WHERE repo = ? AND number = ?", repo, number).Scan(&muted)
+	err := s.db.QueryRow("SELECT muted FROM prs WHERE repo = ? AND number = ?", repo, number).Scan(&muted)
 	if err != nil {
 		return false
 	}
 	return muted != 0
 }
 
-func dbMutedCount() int {
+func (s *sqliteStore) MutedCount() int {
 	var count int
-	db.QueryRow("SELECT COUNT(*) FROM prs WHERE muted = 1").Scan(&count)
+	s.db.QueryRow("SELECT COUNT(*) FROM prs WHERE muted = 1").Scan(&count)
 	return count
 }
 
-func dbClearMuted() error {
-	_, err := db.Exec("DELETE FROM prs WHERE muted = 1")
+func (s *sqliteStore) ClearMuted() error {
+	keys, err := s.flaggedPRs("muted")
+	if err != nil {
+		return err
+	}
+	if _, err := s.db.Exec("DELETE FROM prs WHERE muted = 1"); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		recordTriage(triageUnmute, k.repo, k.number)
+	}
+	return nil
+}
+
+// PRReason returns the stored reason for a PR, or "" if unknown.
+func (s *sqliteStore) PRReason(repo string, number int) string {
+	var reason string
+	s.db.QueryRow("SELECT reason FROM prs WHERE repo = ? AND number = ?", repo, number).Scan(&reason)
+	return reason
+}
+
+func (s *sqliteStore) SetFollowUp(repo string, number int, followUp bool) error {
+	_, err := s.db.Exec("UPDATE prs SET follow_up = ? WHERE repo = ? AND number = ?", boolToInt(followUp), repo, number)
+	return err
+}
+
+func (s *sqliteStore) IsFollowUp(repo string, number int) bool {
+	var followUp int
+	err := s.db.QueryRow("SELECT follow_up FROM prs WHERE repo = ? AND number = ?", repo, number).Scan(&followUp)
+	if err != nil {
+		return false
+	}
+	return followUp != 0
+}
+
+// setIgnored and setMuted write the flag without recording a triage event,
+// so they can be used to apply events received from other devices.
+func setIgnored(ex dbExecer, repo string, number int, ignored bool) error {
+	if !ignored {
+		_, err := ex.Exec("UPDATE prs SET ignored = 0 WHERE repo = ? AND number = ?", repo, number)
+		return err
+	}
+	_, err := ex.Exec(`
+		INSERT INTO prs (repo, number, title, author, url, ignored, last_checked)
+		VALUES (?, ?, '', '', '', 1, ?)
+		ON CONFLICT (repo, number) DO UPDATE SET ignored = 1
+	`, repo, number, time.Now().Format(time.RFC3339))
+	return err
+}
+
+func setMuted(ex dbExecer, repo string, number int, muted bool) error {
+	if !muted {
+		_, err := ex.Exec("UPDATE prs SET muted = 0 WHERE repo = ? AND number = ?", repo, number)
+		return err
+	}
+	_, err := ex.Exec(`
+		INSERT INTO prs (repo, number, title, author, url, muted, last_checked)
+		VALUES (?, ?, '', '', '', 1, ?)
+		ON CONFLICT (repo, number) DO UPDATE SET muted = 1, follow_up = 0
+	`, repo, number, time.Now().Format(time.RFC3339))
+	return err
+}
+
+// dropPlaceholder deletes the row for a PR that was only stored to carry a
+// flag (an ignore or mute from another device or an import) once it carries
+// none, so it doesn't show up as a blank active PR. Local un-mutes don't use
+// it: they're followed by saving the PR's details.
+func dropPlaceholder(ex dbExecer, repo string, number int) error {
+	_, err := ex.Exec("DELETE FROM prs WHERE repo = ? AND number = ? AND url = '' AND ignored = 0 AND muted = 0", repo, number)
 	return err
 }
 
-func dbGetState(key string) string {
+type prRef struct {
+	repo   string
+	number int
+}
+
+// flaggedPRs lists PRs with the given flag column (ignored or muted) set.
+func (s *sqliteStore) flaggedPRs(column string) ([]prRef, error) {
+	rows, err := s.db.Query(fmt.Sprintf("SELECT repo, number FROM prs WHERE %s = 1", column))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []prRef
+	for rows.Next() {
+		var r prRef
+		if err := rows.Scan(&r.repo, &r.number); err != nil {
+			return nil, err
+		}
+		result = append(result, r)
+	}
+	return result, rows.Err()
+}
+
+func (s *sqliteStore) GetState(key string) string {
 	var value string
-	db.QueryRow("SELECT value FROM state WHERE key = ?", key).Scan(&value)
+	s.db.QueryRow("SELECT value FROM state WHERE key = ?", key).Scan(&value)
 	return value
 }
 
-func dbSetState(key, value string) error {
-	_, err := db.Exec(`
+func (s *sqliteStore) SetState(key, value string) error {
+	_, err := s.db.Exec(`
 		INSERT INTO state (key, value) VALUES (?, ?)
 		ON CONFLICT (key) DO UPDATE SET value = excluded.value
 	`, key, value)
 	return err
 }
 
+// StateWithPrefix returns all state keys starting with prefix.
+func (s *sqliteStore) StateWithPrefix(prefix string) map[string]string {
+	result := make(map[string]string)
+	rows, err := s.db.Query("SELECT key, value FROM state WHERE substr(key, 1, ?) = ?", len(prefix), prefix)
+	if err != nil {
+		dbLog().Error("Error loading state", "err", err)
+		return result
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k, v string
+		if rows.Scan(&k, &v) == nil {
+			result[k] = v
+		}
+	}
+	return result
+}
+
 // importIgnoredJSON migrates ignored.json into the database (one-time)
 func importIgnoredJSON() error {
-	if dbGetState("ignored_json_imported") == "true" {
+	if store.GetState("ignored_json_imported") == "true" {
 		return nil
 	}
 
 	ignoredPath := filepath.Join(configDir, "ignored.json")
 	data, err := os.ReadFile(ignoredPath)
 	if os.IsNotExist(err) {
-		return dbSetState("ignored_json_imported", "true")
+		return store.SetState("ignored_json_imported", "true")
 	}
 	if err != nil {
 		return err
@@ -229,14 +408,14 @@ func importIgnoredJSON() error {
 	for _, key := range keys {
 		repo, number := parsePRKey(key)
 		if repo != "" && number > 0 {
-			if err := dbIgnorePR(repo, number); err != nil {
-				log.Printf("Warning: failed to import ignored PR %s: %v", key, err)
+			if err := store.IgnorePR(repo, number); err != nil {
+				dbLog().Warn("Failed to import ignored PR", "pr", key, "err", err)
 			}
 		}
 	}
 
-	log.Printf("Imported %d ignored PRs from ignored.json", len(keys))
-	return dbSetState("ignored_json_imported", "true")
+	dbLog().Info("Imported ignored PRs from ignored.json", "count", len(keys))
+	return store.SetState("ignored_json_imported", "true")
 }
 
 func parsePRKey(key string) (repo string, number int) {
@@ -250,27 +429,52 @@ func parsePRKey(key string) (repo string, number int) {
 	return "", 0
 }
 
+// ThreadProcessed reports whether this update of a notification thread (or a
+// later one) has already been processed.
+func (s *sqliteStore) ThreadProcessed(id string, updatedAt time.Time) bool {
+	var stored string
+	err := s.db.QueryRow("SELECT updated_at FROM notification_threads WHERE id = ?", id).Scan(&stored)
+	if err != nil {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339, stored)
+	return err == nil && !updatedAt.After(t)
+}
+
+func (s *sqliteStore) MarkThreadProcessed(id string, updatedAt time.Time) error {
+	_, err := s.db.Exec(`
+		INSERT INTO notification_threads (id, updated_at, processed_at) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET updated_at = excluded.updated_at, processed_at = excluded.processed_at
+	`, id, updatedAt.UTC().Format(time.RFC3339), time.Now().Format(time.RFC3339))
+	return err
+}
+
+func (s *sqliteStore) PruneProcessedThreads(before time.Time) error {
+	_, err := s.db.Exec("DELETE FROM notification_threads WHERE updated_at < ?", before.UTC().Format(time.RFC3339))
+	return err
+}
+
 type recheckEntry struct {
 	Repo      string
 	Number    int
 	StartedAt time.Time
 }
 
-func dbAddRecheck(repo string, number int) error {
-	_, err := db.Exec(`
+func (s *sqliteStore) AddRecheck(repo string, number int, startedAt time.Time) error {
+	_, err := s.db.Exec(`
 		INSERT INTO rechecks (repo, number, started_at) VALUES (?, ?, ?)
 		ON CONFLICT (repo, number) DO UPDATE SET started_at = excluded.started_at
-	`, repo, number, time.Now().Format(time.RFC3339))
+	`, repo, number, startedAt.Format(time.RFC3339))
 	return err
 }
 
-func dbRemoveRecheck(repo string, number int) error {
-	_, err := db.Exec("DELETE FROM rechecks WHERE repo = ? AND number = ?", repo, number)
+func (s *sqliteStore) RemoveRecheck(repo string, number int) error {
+	_, err := s.db.Exec("DELETE FROM rechecks WHERE repo = ? AND number = ?", repo, number)
 	return err
 }
 
-func dbLoadRechecks() ([]recheckEntry, error) {
-	rows, err := db.Query("SELECT repo, number, started_at FROM rechecks")
+func (s *sqliteStore) LoadRechecks() ([]recheckEntry, error) {
+	rows, err := s.db.Query("SELECT repo, number, started_at FROM rechecks")
 	if err != nil {
 		return nil, err
 	}
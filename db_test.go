@@ -0,0 +1,99 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStoreRefusesNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pr-monitor.db")
+	s, err := openSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest := migrations[len(migrations)-1].version
+	if _, err := s.db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, 'future', '')", latest+1); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	_, err = openSQLiteStore(path)
+	if err == nil || !strings.Contains(err.Error(), "newer than this binary supports") {
+		t.Fatalf("opening newer schema: err = %v", err)
+	}
+}
+
+func TestStoreAdoptsLegacyDatabase(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "pr-monitor.db")
+
+	// A database from before versioned migrations: no schema_migrations, no muted column
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrateInitialSchema(tx); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO prs (repo, number, title, author, url, ignored, last_checked)
+		VALUES ('acme/api', 7, 'Old', 'alice', 'u', 1, '')`); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	s, err := openSQLiteStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if !s.IsIgnored("acme/api", 7) {
+		t.Error("ignored flag lost during migration")
+	}
+	if v, _ := s.schemaVersion(); v != migrations[len(migrations)-1].version {
+		t.Errorf("schema version = %d, want latest", v)
+	}
+	if backups, _ := filepath.Glob(path + ".v0-*.bak"); len(backups) != 1 {
+		t.Errorf("backups = %v, want one", backups)
+	}
+}
+
+func TestReplaceRepoPRsKeepsTriage(t *testing.T) {
+	s, err := openSQLiteStore(filepath.Join(t.TempDir(), "pr-monitor.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	for n := 1; n <= 3; n++ {
+		if err := s.SavePR(PRInfo{Repo: "acme/api", Number: n, Title: "t", Author: "alice", NeedsReview: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.IgnorePR("acme/api", 1)
+	s.MutePR("acme/api", 2)
+
+	if err := s.ReplaceRepoPRs("acme/api", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.IsIgnored("acme/api", 1) || !s.IsMuted("acme/api", 2) {
+		t.Error("triage flags were dropped by ReplaceRepoPRs")
+	}
+	active, err := s.LoadActivePRs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(active) != 0 {
+		t.Errorf("active PRs = %v, want none", active)
+	}
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getlantern/systray"
+	"github.com/google/go-github/v57/github"
+)
+
+// Diagnostics keep track of how refreshes and API calls have been going, so
+// problems such as an expired token, a lapsed SSO authorization or a repo that
+// can no longer be read show up in the Status menu, as a badge on the icon and
+// in `pr-monitor doctor`, rather than only in the log. The latest state is
+// kept in the state table so doctor can report on the running app.
+
+// tokenExpiryWarning is how far ahead of expiry a token is reported.
+const tokenExpiryWarning = 7 * 24 * time.Hour
+
+// maxStatusProblemItems caps the per-repo problem lines in the Status menu.
+const maxStatusProblemItems = 10
+
+type repoHealth struct {
+	LastSuccess time.Time `json:"last_success"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastErrorAt time.Time `json:"last_error_at"`
+}
+
+// failing reports whether the last refresh attempt failed.
+func (h repoHealth) failing() bool {
+	return h.LastError != "" && !h.LastErrorAt.Before(h.LastSuccess)
+}
+
+type tokenHealth struct {
+	// Scopes is X-OAuth-Scopes; fine-grained tokens don't send it
+	Scopes    string    `json:"scopes,omitempty"`
+	Expires   time.Time `json:"expires"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// problem describes what's wrong with the token, if anything.
+func (h tokenHealth) problem() string {
+	switch {
+	case h.LastError != "":
+		return h.LastError
+	case h.Expires.IsZero():
+		return ""
+	case !clock.Now().Before(h.Expires):
+		return "expired " + h.Expires.Local().Format("2006-01-02")
+	case h.Expires.Sub(clock.Now()) < tokenExpiryWarning:
+		return "expires " + h.Expires.Local().Format("2006-01-02 15:04")
+	}
+	return ""
+}
+
+type diagnostics struct {
+	mu     sync.Mutex
+	repos  map[string]repoHealth
+	tokens map[string]tokenHealth
+	// polling is how the app gets updates: notifications or periodic refreshes
+	polling string
+}
+
+var diag = newDiagnostics()
+
+func newDiagnostics() *diagnostics {
+	return &diagnostics{repos: make(map[string]repoHealth), tokens: make(map[string]tokenHealth), polling: "starting"}
+}
+
+// load restores the last recorded state from the database.
+func (d *diagnostics) load() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key, value := range store.StateWithPrefix("health:repo:") {
+		var h repoHealth
+		if json.Unmarshal([]byte(value), &h) == nil {
+			d.repos[strings.TrimPrefix(key, "health:repo:")] = h
+		}
+	}
+	for key, value := range store.StateWithPrefix("health:token:") {
+		var h tokenHealth
+		if json.Unmarshal([]byte(value), &h) == nil {
+			d.tokens[strings.TrimPrefix(key, "health:token:")] = h
+		}
+	}
+}
+
+func (d *diagnostics) repoSucceeded(repo string) {
+	d.updateRepo(repo, func(h *repoHealth) {
+		h.LastSuccess = clock.Now()
+		h.LastError = ""
+	})
+}
+
+func (d *diagnostics) repoFailed(repo string, err error) {
+	d.updateRepo(repo, func(h *repoHealth) {
+		h.LastError = describeAPIError(err)
+		h.LastErrorAt = clock.Now()
+	})
+}
+
+func (d *diagnostics) updateRepo(repo string, fn func(*repoHealth)) {
+	d.mu.Lock()
+	h := d.repos[repo]
+	fn(&h)
+	d.repos[repo] = h
+	d.mu.Unlock()
+
+	saveHealth("health:repo:"+repo, h)
+}
+
+// observeToken records what a response says about the token that made it.
+func (d *diagnostics) observeToken(name string, resp *http.Response) {
+	d.mu.Lock()
+	prev := d.tokens[name]
+	h := prev
+
+	if _, ok := resp.Header["X-Oauth-Scopes"]; ok {
+		h.Scopes = resp.Header.Get("X-OAuth-Scopes")
+	}
+	if exp := resp.Header.Get("GitHub-Authentication-Token-Expiration"); exp != "" {
+		if t, ok := parseTokenExpiration(exp); ok {
+			h.Expires = t
+		}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		h.LastError = "rejected by GitHub (401): revoked or expired"
+	case resp.StatusCode == http.StatusForbidden && resp.Header.Get("X-GitHub-SSO") != "":
+		h.LastError = "needs SAML SSO authorization"
+	case resp.StatusCode < 400:
+		h.LastError = ""
+	}
+
+	d.tokens[name] = h
+	d.mu.Unlock()
+
+	if h != prev {
+		saveHealth("health:token:"+name, h)
+	}
+}
+
+// parseTokenExpiration parses GitHub's token expiry header, e.g.
+// "2025-04-19 21:45:08 UTC" or "2025-04-19 21:45:08 -0700".
+func parseTokenExpiration(s string) (time.Time, bool) {
+	for _, layout := range []string{"2006-01-02 15:04:05 MST", "2006-01-02 15:04:05 -0700"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func saveHealth(key string, v any) {
+	if store == nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	store.SetState(key, string(data))
+}
+
+func (d *diagnostics) setPolling(mode string) {
+	d.mu.Lock()
+	d.polling = mode
+	d.mu.Unlock()
+}
+
+// problems lists everything currently wrong, tokens first, in a stable order.
+func (d *diagnostics) problems() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var out []string
+	for _, name := range sortedKeys(d.tokens) {
+		// Health persists, so a token removed from the config would otherwise
+		// be reported forever
+		if !slices.Contains(tokenNames(), name) {
+			continue
+		}
+		if p := d.tokens[name].problem(); p != "" {
+			out = append(out, fmt.Sprintf("Token %s: %s", name, p))
+		}
+	}
+	for _, repo := range sortedKeys(d.repos) {
+		if h := d.repos[repo]; h.failing() && isConfiguredRepo(repo) {
+			out = append(out, fmt.Sprintf("%s: %s", repo, h.LastError))
+		}
+	}
+	return out
+}
+
+// lastRefresh returns when any repo was last refreshed successfully.
+func (d *diagnostics) lastRefresh() time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var latest time.Time
+	for _, h := range d.repos {
+		if h.LastSuccess.After(latest) {
+			latest = h.LastSuccess
+		}
+	}
+	return latest
+}
+
+func (d *diagnostics) token(name string) tokenHealth {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.tokens[name]
+}
+
+func (d *diagnostics) repo(repo string) repoHealth {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.repos[repo]
+}
+
+func isConfiguredRepo(repo string) bool {
+	for _, r := range config.Repos {
+		if r == repo {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// describeAPIError shortens go-github errors to something that fits in a menu.
+func describeAPIError(err error) string {
+	var ghErr *github.ErrorResponse
+	if errors.As(err, &ghErr) && ghErr.Response != nil {
+		return fmt.Sprintf("%d %s", ghErr.Response.StatusCode, ghErr.Message)
+	}
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		return "rate limited until " + rateErr.Rate.Reset.Local().Format("15:04")
+	}
+	return err.Error()
+}
+
+// tokenObserver feeds every response into diag and metrics, attributed to
+// the named token.
+type tokenObserver struct {
+	base http.RoundTripper
+	name string
+}
+
+func (t *tokenObserver) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	metrics.observeRequest(t.name, resp)
+	if err == nil {
+		diag.observeToken(t.name, resp)
+	}
+	return resp, err
+}
+
+// tokenNames lists configured tokens by the names diagnostics use for them.
+func tokenNames() []string {
+	var names []string
+	if config.GitHubToken != "" {
+		names = append(names, defaultTokenName)
+	}
+	return append(names, sortedKeys(config.OrgTokens)...)
+}
+
+// defaultTokenName is what diagnostics call github_token.
+const defaultTokenName = "default"
+
+func ago(t time.Time) string {
+	d := clock.Since(t)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+}
+
+// Status menu
+
+type statusMenu struct {
+	parent   *systray.MenuItem
+	mode     *systray.MenuItem
+	refresh  *systray.MenuItem
+	tokens   map[string]*systray.MenuItem
+	problems []*systray.MenuItem
+}
+
+var mStatus *statusMenu
+
+func addStatusMenu() {
+	m := &statusMenu{tokens: make(map[string]*systray.MenuItem)}
+	m.parent = systray.AddMenuItem("Status", "Refresh and token health")
+	m.mode = m.parent.AddSubMenuItem("", "")
+	m.refresh = m.parent.AddSubMenuItem("", "")
+	for _, name := range tokenNames() {
+		m.tokens[name] = m.parent.AddSubMenuItem("", "")
+	}
+	for range maxStatusProblemItems {
+		item := m.parent.AddSubMenuItem("", "")
+		item.Hide()
+		m.problems = append(m.problems, item)
+	}
+
+	for _, item := range append([]*systray.MenuItem{m.mode, m.refresh}, m.problems...) {
+		item.Disable()
+	}
+	for _, item := range m.tokens {
+		item.Disable()
+	}
+	mStatus = m
+}
+
+func updateStatusMenu(problems []string) {
+	m := mStatus
+	if m == nil {
+		return
+	}
+
+	if len(problems) == 0 {
+		m.parent.SetTitle("Status: OK")
+	} else {
+		m.parent.SetTitle(fmt.Sprintf("Status: %d problem(s)", len(problems)))
+	}
+
+	diag.mu.Lock()
+	polling := diag.polling
+	diag.mu.Unlock()
+	m.mode.SetTitle(fmt.Sprintf("Updates: %s, notifications %s", polling, config.NotificationMode))
+
+	if last := diag.lastRefresh(); last.IsZero() {
+		m.refresh.SetTitle("Last refresh: never")
+	} else {
+		m.refresh.SetTitle("Last refresh: " + ago(last))
+	}
+
+	for name, item := range m.tokens {
+		item.SetTitle(fmt.Sprintf("Token %s: %s", name, describeToken(diag.token(name))))
+	}
+
+	// Token problems already have their own line
+	var repoProblems []string
+	for _, p := range problems {
+		if !strings.HasPrefix(p, "Token ") {
+			repoProblems = append(repoProblems, p)
+		}
+	}
+	for i, item := range m.problems {
+		if i < len(repoProblems) {
+			item.SetTitle(truncate(repoProblems[i], 70))
+			item.Show()
+		} else {
+			item.Hide()
+		}
+	}
+}
+
+func describeToken(h tokenHealth) string {
+	if p := h.problem(); p != "" {
+		return p
+	}
+	var parts []string
+	if h.Scopes != "" {
+		parts = append(parts, "scopes "+h.Scopes)
+	}
+	if !h.Expires.IsZero() {
+		parts = append(parts, "expires "+h.Expires.Local().Format("2006-01-02"))
+	}
+	if len(parts) == 0 {
+		return "OK"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// runDoctor checks the config, database, tokens and repo access and prints a
+// report. It returns an error if anything needs attention.
+func runDoctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// Everything worth knowing ends up in the report
+	slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	if err := loadConfig(); err != nil {
+		fmt.Printf("Config:        %v\n", err)
+		return fmt.Errorf("config is invalid")
+	}
+	fmt.Printf("Config:        OK (%d repos, %d authors)\n", len(config.Repos), len(config.Authors))
+
+	if err := openDB(); err != nil {
+		fmt.Printf("Database:      %v\n", err)
+		return fmt.Errorf("database could not be opened")
+	}
+	defer store.Close()
+	fmt.Printf("Database:      OK (schema version %d)\n", migrations[len(migrations)-1].version)
+	diag.load()
+
+	if len(tokenNames()) == 0 {
+		fmt.Println("Tokens:        none configured")
+		return fmt.Errorf("no GitHub tokens configured")
+	}
+	initClients()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// Failures that aren't recorded as token or repo health, e.g. network errors
+	var unrecorded []string
+
+	fmt.Println("\nTokens:")
+	for _, name := range tokenNames() {
+		client := clients.Default()
+		if name != defaultTokenName {
+			client = clients.ForOrg(name)
+		}
+		user, _, err := client.Users.Get(ctx, "")
+		status := describeToken(diag.token(name))
+		if err == nil {
+			status = "@" + user.GetLogin() + ", " + status
+		} else if diag.token(name).problem() == "" {
+			status = describeAPIError(err)
+			unrecorded = append(unrecorded, fmt.Sprintf("Token %s: %s", name, status))
+		}
+		fmt.Printf("  %-20s %s\n", name, status)
+	}
+
+	fmt.Printf("\nNotifications: mode %s, ", config.NotificationMode)
+	if clients.Default() != nil && validateNotificationAccess(ctx) {
+		fmt.Println("API access OK")
+	} else {
+		fmt.Println("API unavailable, the app falls back to periodic refreshes")
+	}
+
+	fmt.Println("\nRepos:")
+	for _, repo := range config.Repos {
+		owner, name := parseRepo(repo)
+		status := "OK"
+		if client := getClientForOrg(owner); client == nil {
+			status = "no token"
+		} else if _, _, err := client.Repositories.Get(ctx, owner, name); err != nil {
+			status = describeAPIError(err)
+			diag.repoFailed(repo, err)
+		}
+
+		if h := diag.repo(repo); !h.LastSuccess.IsZero() {
+			status += ", last refreshed " + ago(h.LastSuccess)
+		} else {
+			status += ", never refreshed"
+		}
+		fmt.Printf("  %-40s %s\n", repo, status)
+	}
+
+	problems := append(unrecorded, diag.problems()...)
+	if len(problems) == 0 {
+		fmt.Println("\nNo problems found.")
+		return nil
+	}
+	fmt.Println("\nProblems:")
+	for _, p := range problems {
+		fmt.Println("  - " + p)
+	}
+	return fmt.Errorf("%d problem(s) found", len(problems))
+}
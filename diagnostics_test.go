@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDiagnosticsTrackRepoFailures(t *testing.T) {
+	gh, clk := setupTest(t)
+	gh.addPR(1, "alice")
+	gh.mu.Lock()
+	gh.failRepos["acme/api"] = true
+	gh.mu.Unlock()
+
+	refreshAllRepos(t.Context())
+
+	problems := diag.problems()
+	if len(problems) != 1 || !strings.HasPrefix(problems[0], "acme/api: 500") {
+		t.Fatalf("problems = %q, want a 500 for acme/api", problems)
+	}
+
+	gh.mu.Lock()
+	gh.failRepos["acme/api"] = false
+	gh.mu.Unlock()
+	clk.Advance(time.Minute)
+	refreshAllRepos(t.Context())
+
+	if problems := diag.problems(); len(problems) != 0 {
+		t.Errorf("problems = %q after a successful refresh, want none", problems)
+	}
+	if got := diag.repo("acme/api").LastSuccess; !got.Equal(clk.Now()) {
+		t.Errorf("last success = %v, want %v", got, clk.Now())
+	}
+}
+
+func TestDiagnosticsTrackTokenHeaders(t *testing.T) {
+	gh, _ := setupTest(t)
+	config.GitHubToken = "token"
+	gh.headers = http.Header{
+		"X-Oauth-Scopes":                         {"notifications, repo"},
+		"Github-Authentication-Token-Expiration": {testNow.Add(72 * time.Hour).Format("2006-01-02 15:04:05 MST")},
+	}
+
+	if _, _, err := clients.Default().Users.Get(t.Context(), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	h := diag.token(defaultTokenName)
+	if h.Scopes != "notifications, repo" {
+		t.Errorf("scopes = %q", h.Scopes)
+	}
+	if !h.Expires.Equal(testNow.Add(72 * time.Hour)) {
+		t.Errorf("expires = %v, want %v", h.Expires, testNow.Add(72*time.Hour))
+	}
+	if problems := diag.problems(); len(problems) != 1 || !strings.Contains(problems[0], "expires") {
+		t.Errorf("problems = %q, want an expiry warning", problems)
+	}
+}
+
+func TestDiagnosticsTrackRejectedTokens(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.status = http.StatusUnauthorized
+
+	clients.Default().Users.Get(t.Context(), "")
+	if p := diag.token(defaultTokenName).problem(); !strings.Contains(p, "401") {
+		t.Errorf("token problem = %q, want a 401", p)
+	}
+
+	gh.mu.Lock()
+	gh.status = 0
+	gh.mu.Unlock()
+	clients.Default().Users.Get(t.Context(), "")
+	if p := diag.token(defaultTokenName).problem(); p != "" {
+		t.Errorf("token problem = %q after a successful request, want none", p)
+	}
+}
+
+func TestDiagnosticsPersist(t *testing.T) {
+	gh, _ := setupTest(t)
+	config.GitHubToken = "token"
+	gh.status = http.StatusForbidden
+	gh.headers = http.Header{"X-Github-Sso": {"required; url=https://github.com/orgs/acme/sso"}}
+	clients.Default().Users.Get(t.Context(), "")
+	diag.repoSucceeded("acme/api")
+
+	// A fresh process (or doctor) sees the same state
+	diag = newDiagnostics()
+	diag.load()
+
+	want := []string{"Token default: needs SAML SSO authorization"}
+	if got := diag.problems(); !slices.Equal(got, want) {
+		t.Errorf("problems = %q, want %q", got, want)
+	}
+	if diag.repo("acme/api").LastSuccess.IsZero() {
+		t.Error("repo health was not persisted")
+	}
+
+	// Removing the token from the config clears its problem
+	config.GitHubToken = ""
+	config.OrgTokens = map[string]string{"acme": "acme-token"}
+	if got := diag.problems(); len(got) != 0 {
+		t.Errorf("problems = %q after removing the token, want none", got)
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// exportVersion is bumped whenever the export document changes incompatibly.
+const exportVersion = 1
+
+// exportDoc is the JSON document written by `pr-monitor export` and read by
+// `pr-monitor import`.
+type exportDoc struct {
+	Version    int               `json:"version"`
+	ExportedAt time.Time         `json:"exported_at"`
+	Ignored    []exportPR        `json:"ignored"`
+	Muted      []exportPR        `json:"muted"`
+	Rechecks   []exportRecheck   `json:"rechecks"`
+	State      map[string]string `json:"state"`
+}
+
+// machineLocalState are prefixes of state keys that only make sense in the
+// database that wrote them: sync log offsets, the notifications cursor and
+// first-run cleanup, token and repo health, and when PRs were last opened
+// here. Export leaves them out, import ignores them and replace keeps them,
+// so importing another machine's export can't make this one skip sync events
+// or notifications.
+var machineLocalState = []string{
+	"sync_offset:",
+	"notifications_",
+	"initial_cleanup_done",
+	"ignored_json_imported",
+	"health:",
+	"opened:",
+}
+
+func isMachineLocalState(key string) bool {
+	for _, prefix := range machineLocalState {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type exportPR struct {
+	Repo   string `json:"repo"`
+	Number int    `json:"number"`
+}
+
+type exportRecheck struct {
+	Repo      string    `json:"repo"`
+	Number    int       `json:"number"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	out := fs.String("o", "", "write to `file` instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if err := openDBForCommand(); err != nil {
+		return err
+	}
+	defer store.Close()
+
+	doc, err := store.Export()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if *out == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(*out, data, 0600); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d ignored, %d muted, %d rechecks, %d state keys to %s\n",
+		len(doc.Ignored), len(doc.Muted), len(doc.Rechecks), len(doc.State), *out)
+	return nil
+}
+
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	mode := fs.String("mode", "merge", "merge adds to existing state, replace discards it first")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected a single file argument (use - for stdin)")
+	}
+	if *mode != "merge" && *mode != "replace" {
+		return fmt.Errorf("unknown mode %q: expected merge or replace", *mode)
+	}
+
+	var data []byte
+	var err error
+	if path := fs.Arg(0); path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	var doc exportDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("parsing export: %w", err)
+	}
+	if doc.Version < 1 || doc.Version > exportVersion {
+		return fmt.Errorf("unsupported export version %d (this binary supports up to %d)", doc.Version, exportVersion)
+	}
+
+	if err := openDBForCommand(); err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if err := importDoc(doc, *mode == "replace"); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Imported %d ignored, %d muted, %d rechecks, %d state keys (%s)\n",
+		len(doc.Ignored), len(doc.Muted), len(doc.Rechecks), len(doc.State), *mode)
+	return nil
+}
+
+// importDoc imports doc and publishes the triage decisions it changes to
+// other devices. With replace, that includes un-ignoring and un-muting PRs
+// the document doesn't flag; otherwise their ignores and mutes would come
+// back the next time this device replays the sync logs.
+func importDoc(doc exportDoc, replace bool) error {
+	var before exportDoc
+	if replace {
+		var err error
+		if before, err = store.Export(); err != nil {
+			return err
+		}
+	}
+
+	if err := store.Import(doc, replace); err != nil {
+		return err
+	}
+
+	for _, pr := range before.Ignored {
+		if !slices.Contains(doc.Ignored, pr) {
+			recordTriage(triageUnignore, pr.Repo, pr.Number)
+		}
+	}
+	for _, pr := range before.Muted {
+		if !slices.Contains(doc.Muted, pr) {
+			recordTriage(triageUnmute, pr.Repo, pr.Number)
+		}
+	}
+	for _, pr := range doc.Ignored {
+		recordTriage(triageIgnore, pr.Repo, pr.Number)
+	}
+	for _, pr := range doc.Muted {
+		recordTriage(triageMute, pr.Repo, pr.Number)
+	}
+	return nil
+}
+
+func (s *sqliteStore) Export() (exportDoc, error) {
+	doc := exportDoc{
+		Version:    exportVersion,
+		ExportedAt: time.Now().UTC(),
+		Ignored:    []exportPR{},
+		Muted:      []exportPR{},
+		Rechecks:   []exportRecheck{},
+		State:      map[string]string{},
+	}
+
+	ignored, err := s.flaggedPRs("ignored")
+	if err != nil {
+		return doc, fmt.Errorf("loading ignored PRs: %w", err)
+	}
+	for _, r := range ignored {
+		doc.Ignored = append(doc.Ignored, exportPR{Repo: r.repo, Number: r.number})
+	}
+
+	muted, err := s.flaggedPRs("muted")
+	if err != nil {
+		return doc, fmt.Errorf("loading muted PRs: %w", err)
+	}
+	for _, r := range muted {
+		doc.Muted = append(doc.Muted, exportPR{Repo: r.repo, Number: r.number})
+	}
+
+	rechecks, err := s.LoadRechecks()
+	if err != nil {
+		return doc, fmt.Errorf("loading rechecks: %w", err)
+	}
+	for _, e := range rechecks {
+		doc.Rechecks = append(doc.Rechecks, exportRecheck{Repo: e.Repo, Number: e.Number, StartedAt: e.StartedAt})
+	}
+
+	rows, err := s.db.Query("SELECT key, value FROM state ORDER BY key")
+	if err != nil {
+		return doc, fmt.Errorf("loading state: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return doc, err
+		}
+		if !isMachineLocalState(k) {
+			doc.State[k] = v
+		}
+	}
+
+	return doc, rows.Err()
+}
+
+// Import writes doc to the database in a single transaction. With replace,
+// existing ignored/muted flags, rechecks and state are discarded first.
+func (s *sqliteStore) Import(doc exportDoc, replace bool) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if replace {
+		for _, stmt := range []string{
+			// As Clear Ignored/Muted do: an ignored or muted row may be a
+			// placeholder with no details, and the next refresh re-adds real PRs
+			"DELETE FROM prs WHERE ignored = 1 OR muted = 1",
+			"DELETE FROM rechecks",
+		} {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		if err := deletePortableState(tx); err != nil {
+			return err
+		}
+	}
+
+	for _, pr := range doc.Ignored {
+		if err := setIgnored(tx, pr.Repo, pr.Number, true); err != nil {
+			return fmt.Errorf("importing ignored %s#%d: %w", pr.Repo, pr.Number, err)
+		}
+	}
+	for _, pr := range doc.Muted {
+		if err := setMuted(tx, pr.Repo, pr.Number, true); err != nil {
+			return fmt.Errorf("importing muted %s#%d: %w", pr.Repo, pr.Number, err)
+		}
+	}
+	for _, e := range doc.Rechecks {
+		if _, err := tx.Exec(`
+			INSERT INTO rechecks (repo, number, started_at) VALUES (?, ?, ?)
+			ON CONFLICT (repo, number) DO UPDATE SET started_at = excluded.started_at
+		`, e.Repo, e.Number, e.StartedAt.Format(time.RFC3339)); err != nil {
+			return fmt.Errorf("importing recheck %s#%d: %w", e.Repo, e.Number, err)
+		}
+	}
+	for k, v := range doc.State {
+		if isMachineLocalState(k) {
+			continue
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO state (key, value) VALUES (?, ?)
+			ON CONFLICT (key) DO UPDATE SET value = excluded.value
+		`, k, v); err != nil {
+			return fmt.Errorf("importing state %s: %w", k, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// deletePortableState clears the state keys an export carries.
+func deletePortableState(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT key FROM state")
+	if err != nil {
+		return err
+	}
+	var keys []string
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			rows.Close()
+			return err
+		}
+		if !isMachineLocalState(k) {
+			keys = append(keys, k)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if _, err := tx.Exec("DELETE FROM state WHERE key = ?", k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
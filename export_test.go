@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// roundTrip exports the store and parses the JSON back, as export | import would.
+func roundTrip(t *testing.T) exportDoc {
+	t.Helper()
+	doc, err := store.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed exportDoc
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func deviceLogActions(t *testing.T, device string) []string {
+	t.Helper()
+	f, err := os.Open(syncLogPath(device))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var actions []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var e triageEvent
+		json.Unmarshal(scanner.Bytes(), &e)
+		actions = append(actions, e.Action+" "+prAttr(e.Repo, e.Number).Value.String())
+	}
+	return actions
+}
+
+func TestExportImportMerge(t *testing.T) {
+	setupTest(t)
+	store.IgnorePR("acme/api", 7)
+	store.MutePR("acme/api", 8)
+	store.SetState("last_full_refresh", "yesterday")
+	doc := roundTrip(t)
+
+	// Into another machine's database, which has decisions of its own
+	other, err := openSQLiteStore(filepath.Join(t.TempDir(), "other.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	store = other
+	store.IgnorePR("acme/api", 9)
+
+	if err := importDoc(doc, false); err != nil {
+		t.Fatal(err)
+	}
+	if !store.IsIgnored("acme/api", 7) || !store.IsMuted("acme/api", 8) {
+		t.Error("imported ignore and mute weren't applied")
+	}
+	if !store.IsIgnored("acme/api", 9) {
+		t.Error("merge dropped an existing ignore")
+	}
+	if got := store.GetState("last_full_refresh"); got != "yesterday" {
+		t.Errorf("state = %q, want the imported value", got)
+	}
+}
+
+func TestImportReplaceClearsSyncedDecisions(t *testing.T) {
+	clk := setupSync(t)
+	store.IgnorePR("acme/api", 7)
+	store.IgnorePR("acme/api", 9)
+	store.MutePR("acme/api", 8)
+	store.SetState("stale", "x")
+
+	clk.Advance(time.Hour)
+	if err := importDoc(exportDoc{Version: exportVersion, Ignored: []exportPR{{"acme/api", 7}}}, true); err != nil {
+		t.Fatal(err)
+	}
+	if !store.IsIgnored("acme/api", 7) || store.IsIgnored("acme/api", 9) || store.IsMuted("acme/api", 8) {
+		t.Error("replace should leave exactly the imported ignore")
+	}
+	if active, _ := store.LoadActivePRs(); len(active) != 0 {
+		t.Errorf("active PRs = %+v; cleared placeholders shouldn't become blank PRs", active)
+	}
+	if got := store.GetState("stale"); got != "" {
+		t.Errorf("state = %q, want it discarded", got)
+	}
+
+	// Other devices are told, and replaying the logs doesn't undo the replace
+	actions := deviceLogActions(t, syncDevice)
+	for _, want := range []string{"unignore acme/api#9", "unmute acme/api#8"} {
+		if !slices.Contains(actions, want) {
+			t.Errorf("sync log = %v, missing %q", actions, want)
+		}
+	}
+	if slices.Contains(actions, "unignore acme/api#7") {
+		t.Errorf("sync log = %v; 7 is still ignored", actions)
+	}
+	if _, err := syncTriage(); err != nil {
+		t.Fatal(err)
+	}
+	if store.IsIgnored("acme/api", 9) || store.IsMuted("acme/api", 8) {
+		t.Error("replaying the sync logs brought back cleared decisions")
+	}
+}
+
+func TestImportKeepsMachineLocalState(t *testing.T) {
+	setupTest(t)
+	store.SetState("sync_offset:laptop.jsonl", "120")
+	store.SetState("notifications_since", "2026-10-01T00:00:00Z")
+	store.SetState("last_full_refresh", "today")
+
+	if doc := roundTrip(t); len(doc.State) != 1 || doc.State["last_full_refresh"] != "today" {
+		t.Errorf("exported state = %v, want only last_full_refresh", doc.State)
+	}
+
+	// An export from another machine, or from an older version that carried everything
+	doc := exportDoc{Version: exportVersion, State: map[string]string{
+		"sync_offset:laptop.jsonl": "5",
+		"notifications_since":      "2026-09-01T00:00:00Z",
+		"initial_cleanup_done":     "true",
+	}}
+	for _, replace := range []bool{false, true} {
+		if err := importDoc(doc, replace); err != nil {
+			t.Fatal(err)
+		}
+		if got := store.GetState("sync_offset:laptop.jsonl"); got != "120" {
+			t.Errorf("replace=%v: sync offset = %q, want this machine's 120", replace, got)
+		}
+		if got := store.GetState("notifications_since"); got != "2026-10-01T00:00:00Z" {
+			t.Errorf("replace=%v: notifications_since = %q, want this machine's cursor", replace, got)
+		}
+		if got := store.GetState("initial_cleanup_done"); got != "" {
+			t.Errorf("replace=%v: initial_cleanup_done = %q; the first-run cleanup would be skipped", replace, got)
+		}
+	}
+	if got := store.GetState("last_full_refresh"); got != "" {
+		t.Errorf("last_full_refresh = %q, want it discarded by replace", got)
+	}
+}
@@ -0,0 +1,675 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// testNow is the fake clock's starting time in all tests.
+var testNow = time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+// setupTest points the package globals at a fresh SQLite store, a fake GitHub
+// server and a fake clock, and restores them when the test ends.
+func setupTest(t *testing.T) (*fakeGitHub, *fakeClock) {
+	t.Helper()
+
+	s, err := openSQLiteStore(filepath.Join(t.TempDir(), "pr-monitor.db"))
+	if err != nil {
+		t.Fatalf("opening store: %v", err)
+	}
+
+	gh := newFakeGitHub(t)
+	clk := newFakeClock(testNow)
+
+	oldStore, oldClients, oldClock, oldConfig, oldUser := store, clients, clock, config, currentUser
+	oldCtx, oldCancel, oldDiag, oldMetrics := appCtx, cancelApp, diag, metrics
+	t.Cleanup(func() {
+		// Stop background rechecks before the store goes away
+		cancelApp()
+		background.Wait()
+		s.Close()
+		store, clients, clock, config, currentUser = oldStore, oldClients, oldClock, oldConfig, oldUser
+		appCtx, cancelApp, diag, metrics = oldCtx, oldCancel, oldDiag, oldMetrics
+		prsMutex.Lock()
+		prs = nil
+		prsMutex.Unlock()
+	})
+
+	appCtx, cancelApp = context.WithCancel(context.Background())
+	diag = newDiagnostics()
+	metrics = newPollerMetrics()
+	store = s
+	clients = &tokenClients{defaultClient: gh.client(), orgClients: map[string]*github.Client{}}
+	clock = clk
+	currentUser = "me"
+	config = Config{
+		Repos:            []string{"acme/api"},
+		Authors:          []string{"alice", "bob"},
+		MaxAgeDays:       3,
+		NotificationMode: notificationModeMarkRead,
+	}
+
+	return gh, clk
+}
+
+func countActiveRechecks() int {
+	var n int
+	activeRechecks.Range(func(_, _ any) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// waitFor polls cond until it holds, for assertions on work done by background goroutines.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// fakeGitHub serves the subset of the GitHub REST and GraphQL APIs the poller uses.
+type fakeGitHub struct {
+	t   *testing.T
+	srv *httptest.Server
+
+	mu                    sync.Mutex
+	pulls                 map[string]*github.PullRequest // keyed by owner/repo#number
+	reviews               map[string][]*github.PullRequestReview
+	commits               map[string][]*github.RepositoryCommit
+	files                 map[string][]*github.CommitFile
+	comments              map[string][]*github.IssueComment
+	reviewComments        map[string][]*github.PullRequestComment
+	threads               map[string][]fakeThread
+	notifications         []*github.Notification
+	readThreads           []string
+	failRepos             map[string]bool
+	requests              map[string]int // keyed by "METHOD path"
+	notModified           int            // conditional requests answered with 304
+	maxPerPage            int            // caps per_page on list endpoints when set
+	headers               http.Header    // added to every response
+	status                int            // when set, every request fails with this status
+	failNotificationPages bool           // pages of /notifications after the first fail
+
+	// listDelay holds each PR list request open so tests can observe
+	// concurrency; maxListsInFlight records the peak per org.
+	listDelay        time.Duration
+	listsInFlight    map[string]int
+	maxListsInFlight map[string]int
+}
+
+type fakeThread struct {
+	ID       string
+	Resolved bool
+	Comments []fakeComment
+}
+
+type fakeComment struct {
+	Author string
+	At     time.Time
+}
+
+func newFakeGitHub(t *testing.T) *fakeGitHub {
+	f := &fakeGitHub{
+		t:              t,
+		pulls:          map[string]*github.PullRequest{},
+		reviews:        map[string][]*github.PullRequestReview{},
+		commits:        map[string][]*github.RepositoryCommit{},
+		files:          map[string][]*github.CommitFile{},
+		comments:       map[string][]*github.IssueComment{},
+		reviewComments: map[string][]*github.PullRequestComment{},
+		threads:        map[string][]fakeThread{},
+		failRepos:      map[string]bool{},
+		requests:       map[string]int{},
+
+		listsInFlight:    map[string]int{},
+		maxListsInFlight: map[string]int{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /user", func(w http.ResponseWriter, r *http.Request) {
+		f.json(w, &github.User{Login: github.String(currentUser)})
+	})
+	mux.HandleFunc("GET /repos/{owner}/{repo}/pulls", f.handleListPulls)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/pulls/{number}", f.handleGetPull)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/pulls/{number}/reviews", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.jsonWithETag(w, r, paginate(w, r, f.maxPerPage, f.reviews[prPathKey(r)]))
+	})
+	mux.HandleFunc("POST /repos/{owner}/{repo}/pulls/{number}/reviews", f.handleCreateReview)
+	mux.HandleFunc("POST /repos/{owner}/{repo}/pulls/{number}/requested_reviewers", f.handleRequestReviewers)
+	mux.HandleFunc("DELETE /repos/{owner}/{repo}/pulls/{number}/requested_reviewers", f.handleRequestReviewers)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/issues/{number}/comments", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.json(w, paginate(w, r, f.maxPerPage, f.comments[prPathKey(r)]))
+	})
+	mux.HandleFunc("POST /repos/{owner}/{repo}/issues/{number}/comments", func(w http.ResponseWriter, r *http.Request) {
+		c := &github.IssueComment{}
+		json.NewDecoder(r.Body).Decode(c)
+		c.User = &github.User{Login: github.String(currentUser)}
+		c.CreatedAt = &github.Timestamp{Time: clock.Now()}
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.comments[prPathKey(r)] = append(f.comments[prPathKey(r)], c)
+		w.WriteHeader(http.StatusCreated)
+		f.json(w, c)
+	})
+	mux.HandleFunc("GET /repos/{owner}/{repo}/pulls/{number}/comments", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.json(w, paginate(w, r, f.maxPerPage, f.reviewComments[prPathKey(r)]))
+	})
+	mux.HandleFunc("GET /repos/{owner}/{repo}/pulls/{number}/commits", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.jsonWithETag(w, r, paginate(w, r, f.maxPerPage, f.commits[prPathKey(r)]))
+	})
+	mux.HandleFunc("GET /repos/{owner}/{repo}/pulls/{number}/files", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.json(w, paginate(w, r, f.maxPerPage, f.files[prPathKey(r)]))
+	})
+	mux.HandleFunc("GET /notifications", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if page, _ := strconv.Atoi(r.URL.Query().Get("page")); f.failNotificationPages && page > 1 {
+			http.Error(w, `{"message":"forced failure"}`, http.StatusBadGateway)
+			return
+		}
+		f.json(w, paginate(w, r, f.maxPerPage, f.notifications))
+	})
+	mux.HandleFunc("PUT /notifications", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusResetContent)
+	})
+	mux.HandleFunc("PATCH /notifications/threads/{id}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.readThreads = append(f.readThreads, r.PathValue("id"))
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusResetContent)
+	})
+	mux.HandleFunc("POST /graphql", f.handleGraphQL)
+
+	f.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.requests[r.Method+" "+r.URL.Path]++
+		for k, v := range f.headers {
+			w.Header()[k] = v
+		}
+		status := f.status
+		f.mu.Unlock()
+
+		if status != 0 {
+			http.Error(w, `{"message":"forced failure"}`, status)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+// client returns a client for the fake, with the same ETag caching as real clients.
+func (f *fakeGitHub) client() *github.Client {
+	c := github.NewClient(&http.Client{Transport: &etagTransport{
+		base:  &tokenObserver{base: http.DefaultTransport, name: defaultTokenName},
+		scope: "test",
+	}})
+	u, _ := url.Parse(f.srv.URL + "/")
+	c.BaseURL = u
+	return c
+}
+
+func (f *fakeGitHub) json(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		f.t.Errorf("encoding fake response: %v", err)
+	}
+}
+
+// jsonWithETag answers conditional requests like GitHub: 304 with no body
+// when If-None-Match matches the current representation.
+func (f *fakeGitHub) jsonWithETag(w http.ResponseWriter, r *http.Request, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		f.t.Errorf("encoding fake response: %v", err)
+		return
+	}
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		f.notModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// paginate returns the page of items r asks for and links the next one the
+// way GitHub does. maxPerPage, if set, overrides a larger per_page.
+func paginate[T any](w http.ResponseWriter, r *http.Request, maxPerPage int, items []T) []T {
+	q := r.URL.Query()
+	page, _ := strconv.Atoi(q.Get("page"))
+	page = max(page, 1)
+	perPage, _ := strconv.Atoi(q.Get("per_page"))
+	if perPage <= 0 {
+		perPage = 30
+	}
+	if maxPerPage > 0 {
+		perPage = min(perPage, maxPerPage)
+	}
+
+	start := min((page-1)*perPage, len(items))
+	end := min(start+perPage, len(items))
+	if end < len(items) {
+		q.Set("page", strconv.Itoa(page+1))
+		next := url.URL{Scheme: "http", Host: r.Host, Path: r.URL.Path, RawQuery: q.Encode()}
+		w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.String()))
+	}
+	return items[start:end]
+}
+
+func prPathKey(r *http.Request) string {
+	return fmt.Sprintf("%s/%s#%s", r.PathValue("owner"), r.PathValue("repo"), r.PathValue("number"))
+}
+
+func (f *fakeGitHub) handleListPulls(w http.ResponseWriter, r *http.Request) {
+	owner := r.PathValue("owner")
+	f.mu.Lock()
+	f.listsInFlight[owner]++
+	f.maxListsInFlight[owner] = max(f.maxListsInFlight[owner], f.listsInFlight[owner])
+	delay := f.listDelay
+	f.mu.Unlock()
+
+	time.Sleep(delay)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.listsInFlight[owner]--
+
+	repo := r.PathValue("owner") + "/" + r.PathValue("repo")
+	if f.failRepos[repo] {
+		http.Error(w, `{"message":"boom"}`, http.StatusInternalServerError)
+		return
+	}
+
+	var result []*github.PullRequest
+	for key, pr := range f.pulls {
+		if r, _ := parsePRKey(key); r == repo && pr.GetState() == "open" {
+			result = append(result, pr)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].GetNumber() < result[j].GetNumber() })
+	if r.URL.Query().Get("sort") == "updated" && r.URL.Query().Get("direction") == "desc" {
+		sort.SliceStable(result, func(i, j int) bool {
+			return result[i].GetUpdatedAt().After(result[j].GetUpdatedAt().Time)
+		})
+	}
+	f.jsonWithETag(w, r, paginate(w, r, f.maxPerPage, result))
+}
+
+func (f *fakeGitHub) handleGetPull(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	pr, ok := f.pulls[prPathKey(r)]
+	if !ok {
+		http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+		return
+	}
+	f.json(w, pr)
+}
+
+// handleCreateReview records a review by the current user and, like GitHub,
+// drops their pending review request.
+func (f *fakeGitHub) handleCreateReview(w http.ResponseWriter, r *http.Request) {
+	var req github.PullRequestReviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	states := map[string]string{"APPROVE": "APPROVED", "REQUEST_CHANGES": "CHANGES_REQUESTED", "COMMENT": "COMMENTED"}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := prPathKey(r)
+	pr, ok := f.pulls[key]
+	if !ok {
+		http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+		return
+	}
+	review := &github.PullRequestReview{
+		User:        &github.User{Login: github.String(currentUser)},
+		State:       github.String(states[req.GetEvent()]),
+		Body:        req.Body,
+		SubmittedAt: &github.Timestamp{Time: clock.Now()},
+	}
+	f.reviews[key] = append(f.reviews[key], review)
+
+	var still []*github.User
+	for _, u := range pr.RequestedReviewers {
+		if u.GetLogin() != currentUser {
+			still = append(still, u)
+		}
+	}
+	pr.RequestedReviewers = still
+	f.json(w, review)
+}
+
+// handleRequestReviewers adds (POST) or removes (DELETE) requested reviewers
+// and teams.
+func (f *fakeGitHub) handleRequestReviewers(w http.ResponseWriter, r *http.Request) {
+	var req github.ReviewersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pr, ok := f.pulls[prPathKey(r)]
+	if !ok {
+		http.Error(w, `{"message":"Not Found"}`, http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodPost {
+		for _, login := range req.Reviewers {
+			pr.RequestedReviewers = append(pr.RequestedReviewers, &github.User{Login: github.String(login)})
+		}
+		for _, slug := range req.TeamReviewers {
+			pr.RequestedTeams = append(pr.RequestedTeams, &github.Team{Slug: github.String(slug)})
+		}
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		var still []*github.User
+		for _, u := range pr.RequestedReviewers {
+			if !slices.Contains(req.Reviewers, u.GetLogin()) {
+				still = append(still, u)
+			}
+		}
+		pr.RequestedReviewers = still
+	}
+	f.json(w, pr)
+}
+
+func (f *fakeGitHub) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Variables struct {
+			Owner  string `json:"owner"`
+			Name   string `json:"name"`
+			Number int    `json:"number"`
+		} `json:"variables"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	type comment struct {
+		Author struct {
+			Login string `json:"login"`
+		} `json:"author"`
+		CreatedAt time.Time `json:"createdAt"`
+	}
+	type thread struct {
+		ID         string `json:"id"`
+		IsResolved bool   `json:"isResolved"`
+		Comments   struct {
+			Nodes []comment `json:"nodes"`
+		} `json:"comments"`
+	}
+
+	var nodes []thread
+	key := fmt.Sprintf("%s/%s#%d", req.Variables.Owner, req.Variables.Name, req.Variables.Number)
+	for _, ft := range f.threads[key] {
+		th := thread{ID: ft.ID, IsResolved: ft.Resolved}
+		for _, c := range ft.Comments {
+			var cm comment
+			cm.Author.Login = c.Author
+			cm.CreatedAt = c.At
+			th.Comments.Nodes = append(th.Comments.Nodes, cm)
+		}
+		nodes = append(nodes, th)
+	}
+
+	resp := map[string]any{
+		"data": map[string]any{
+			"repository": map[string]any{
+				"pullRequest": map[string]any{
+					"reviewThreads": map[string]any{"nodes": nodes},
+				},
+			},
+		},
+	}
+	f.json(w, resp)
+}
+
+// addPR registers an open PR in acme/api created an hour before testNow.
+func (f *fakeGitHub) addPR(number int, author string, opts ...func(*github.PullRequest)) *github.PullRequest {
+	return f.addRepoPR("acme/api", number, author, opts...)
+}
+
+func (f *fakeGitHub) addRepoPR(repo string, number int, author string, opts ...func(*github.PullRequest)) *github.PullRequest {
+	pr := &github.PullRequest{
+		Number:    github.Int(number),
+		Title:     github.String(fmt.Sprintf("PR %d", number)),
+		State:     github.String("open"),
+		User:      &github.User{Login: github.String(author)},
+		HTMLURL:   github.String(fmt.Sprintf("https://github.com/%s/pull/%d", repo, number)),
+		CreatedAt: &github.Timestamp{Time: testNow.Add(-time.Hour)},
+		UpdatedAt: &github.Timestamp{Time: testNow.Add(-time.Hour)},
+	}
+	for _, o := range opts {
+		o(pr)
+	}
+
+	f.mu.Lock()
+	f.pulls[repo+"#"+strconv.Itoa(number)] = pr
+	f.mu.Unlock()
+	return pr
+}
+
+func (f *fakeGitHub) update(number int, fn func(*github.PullRequest)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fn(f.pulls["acme/api#"+strconv.Itoa(number)])
+}
+
+func requested(logins ...string) func(*github.PullRequest) {
+	return func(pr *github.PullRequest) {
+		pr.RequestedReviewers = nil
+		for _, l := range logins {
+			pr.RequestedReviewers = append(pr.RequestedReviewers, &github.User{Login: github.String(l)})
+		}
+	}
+}
+
+func (f *fakeGitHub) addReview(number int, user, state string, at time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := "acme/api#" + strconv.Itoa(number)
+	f.reviews[key] = append(f.reviews[key], &github.PullRequestReview{
+		User:        &github.User{Login: github.String(user)},
+		State:       github.String(state),
+		SubmittedAt: &github.Timestamp{Time: at},
+	})
+}
+
+func (f *fakeGitHub) addCommit(number int, at time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	key := "acme/api#" + strconv.Itoa(number)
+	f.commits[key] = append(f.commits[key], &github.RepositoryCommit{
+		Commit: &github.Commit{Committer: &github.CommitAuthor{Date: &github.Timestamp{Time: at}}},
+	})
+}
+
+func (f *fakeGitHub) setThreads(number int, threads ...fakeThread) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.threads["acme/api#"+strconv.Itoa(number)] = threads
+}
+
+func (f *fakeGitHub) requestCount(method, path string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[method+" "+path]
+}
+
+func (f *fakeGitHub) markedRead() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.readThreads...)
+}
+
+// prNotification builds an unread notification for a PR in repo.
+func prNotification(id, repo string, number int, reason string, updatedAt time.Time) *github.Notification {
+	return &github.Notification{
+		ID:     github.String(id),
+		Reason: github.String(reason),
+		Subject: &github.NotificationSubject{
+			Type: github.String("PullRequest"),
+			URL:  github.String(fmt.Sprintf("https://api.github.com/repos/%s/pulls/%d", repo, number)),
+		},
+		Repository: &github.Repository{FullName: github.String(repo)},
+		UpdatedAt:  &github.Timestamp{Time: updatedAt},
+	}
+}
+
+// fakeClock only moves when Advance is called.
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+	tickers []*fakeTicker
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock(now time.Time) *fakeClock {
+	return &fakeClock{now: now}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeWaiter{at: c.now.Add(d), ch: ch})
+	return ch
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &fakeTicker{clock: c, period: d, next: c.now.Add(d), ch: make(chan time.Time, 1)}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// Advance moves time forward, firing any timers and tickers that fall due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	remaining := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			remaining = append(remaining, w)
+			continue
+		}
+		w.ch <- c.now
+	}
+	c.waiters = remaining
+
+	for _, t := range c.tickers {
+		if t.stopped || t.next.After(c.now) {
+			continue
+		}
+		select {
+		case t.ch <- c.now:
+		default:
+		}
+		for !t.next.After(c.now) {
+			t.next = t.next.Add(t.period)
+		}
+	}
+}
+
+// Waiters returns how many After timers are pending.
+func (c *fakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+type fakeTicker struct {
+	clock   *fakeClock
+	period  time.Duration
+	next    time.Time
+	stopped bool
+	ch      chan time.Time
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTicker) Reset(d time.Duration) {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.period = d
+	t.next = t.clock.now.Add(d)
+	t.stopped = false
+}
+
+func (t *fakeTicker) Stop() {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	t.stopped = true
+}
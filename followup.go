@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// Follow-ups resurface PRs that were muted after you reviewed them once the
+// author answers in a review thread you took part in, or a thread of yours is
+// resolved or unresolved. Review thread resolution is only exposed through
+// GraphQL, so threads are fetched there rather than via the REST comments API.
+
+// isFollowUpReason reports whether a notification reason can indicate activity
+// on review threads.
+func isFollowUpReason(reason string) bool {
+	return reason == "comment" || reason == "mention"
+}
+
+type reviewThread struct {
+	ID            string
+	Resolved      bool
+	Participated  bool
+	LastAuthor    string
+	LastCommentAt time.Time
+}
+
+const reviewThreadsQuery = `
+query($owner: String!, $name: String!, $number: Int!) {
+  repository(owner: $owner, name: $name) {
+    pullRequest(number: $number) {
+      reviewThreads(first: 100) {
+        nodes {
+          id
+          isResolved
+          comments(last: 100) {
+            nodes {
+              author { login }
+              createdAt
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+func fetchReviewThreads(ctx context.Context, client *github.Client, owner, repo string, number int) ([]reviewThread, error) {
+	var data struct {
+		Repository struct {
+			PullRequest struct {
+				ReviewThreads struct {
+					Nodes []struct {
+						ID         string `json:"id"`
+						IsResolved bool   `json:"isResolved"`
+						Comments   struct {
+							Nodes []struct {
+								Author struct {
+									Login string `json:"login"`
+								} `json:"author"`
+								CreatedAt time.Time `json:"createdAt"`
+							} `json:"nodes"`
+						} `json:"comments"`
+					} `json:"nodes"`
+				} `json:"reviewThreads"`
+			} `json:"pullRequest"`
+		} `json:"repository"`
+	}
+
+	vars := map[string]any{"owner": owner, "name": repo, "number": number}
+	if err := graphQL(ctx, client, reviewThreadsQuery, vars, &data); err != nil {
+		return nil, err
+	}
+
+	var threads []reviewThread
+	for _, node := range data.Repository.PullRequest.ReviewThreads.Nodes {
+		t := reviewThread{ID: node.ID, Resolved: node.IsResolved}
+		for _, c := range node.Comments.Nodes {
+			if c.Author.Login == currentUser {
+				t.Participated = true
+			}
+			t.LastAuthor = c.Author.Login
+			t.LastCommentAt = c.CreatedAt
+		}
+		threads = append(threads, t)
+	}
+	return threads, nil
+}
+
+// checkFollowUp fetches the PR's review threads and reports whether any thread
+// you took part in has changed in a way that needs your attention since it was
+// last seen. The latest thread state is stored either way.
+func checkFollowUp(ctx context.Context, client *github.Client, owner, repoName string, pr *github.PullRequest) bool {
+	if currentUser == "" {
+		return false
+	}
+
+	repo := owner + "/" + repoName
+	threads, err := fetchReviewThreads(ctx, client, owner, repoName, pr.GetNumber())
+	if err != nil {
+		pollerLog().Error("Error fetching review threads", prAttr(repo, pr.GetNumber()), "err", err)
+		return false
+	}
+
+	changed, err := store.UpdateReviewThreads(repo, pr.GetNumber(), pr.GetUser().GetLogin(), threads)
+	if err != nil {
+		dbLog().Error("Error updating review threads", prAttr(repo, pr.GetNumber()), "err", err)
+	}
+	return changed
+}
+
+// followUpStillPending reports whether a follow-up PR still has a thread where
+// the author is waiting on you. Errors keep the follow-up in place.
+func followUpStillPending(ctx context.Context, client *github.Client, owner, repoName string, pr *github.PullRequest) bool {
+	threads, err := fetchReviewThreads(ctx, client, owner, repoName, pr.GetNumber())
+	if err != nil {
+		recheckLog().Error("Error fetching review threads", prAttr(owner+"/"+repoName, pr.GetNumber()), "err", err)
+		return true
+	}
+
+	author := pr.GetUser().GetLogin()
+	for _, t := range threads {
+		if t.Participated && !t.Resolved && t.LastAuthor == author {
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateReviewThreads stores the latest state of threads and reports whether
+// any of them counts as a follow-up compared to what was stored on the previous
+// check. A thread you participated in counts as followed up when the PR author
+// has commented since, or its resolved state flipped. Threads seen for the
+// first time count if the author has the last word.
+func (s *sqliteStore) UpdateReviewThreads(repo string, number int, author string, threads []reviewThread) (bool, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var changed bool
+	for _, t := range threads {
+		if !t.Participated {
+			continue
+		}
+
+		var resolved int
+		var lastCommentAt string
+		err := tx.QueryRow(
+			"SELECT resolved, last_comment_at FROM review_threads WHERE repo = ? AND number = ? AND thread_id = ?",
+			repo, number, t.ID,
+		).Scan(&resolved, &lastCommentAt)
+		switch {
+		case err == sql.ErrNoRows:
+			if t.LastAuthor == author && !t.Resolved {
+				changed = true
+			}
+		case err != nil:
+			return false, err
+		default:
+			prev, _ := time.Parse(time.RFC3339, lastCommentAt)
+			if (resolved != 0) != t.Resolved {
+				changed = true
+			}
+			if t.LastCommentAt.After(prev) && t.LastAuthor == author {
+				changed = true
+			}
+		}
+
+		if _, err := tx.Exec(`
+			INSERT INTO review_threads (repo, number, thread_id, resolved, last_author, last_comment_at)
+			VALUES (?, ?, ?, ?, ?, ?)
+			ON CONFLICT (repo, number, thread_id) DO UPDATE SET
+				resolved = excluded.resolved,
+				last_author = excluded.last_author,
+				last_comment_at = excluded.last_comment_at
+		`, repo, number, t.ID, boolToInt(t.Resolved), t.LastAuthor, t.LastCommentAt.UTC().Format(time.RFC3339)); err != nil {
+			return false, err
+		}
+	}
+
+	return changed, tx.Commit()
+}
+
+// graphQL runs a query against GitHub's GraphQL API using client's credentials
+// and decodes the data field into out.
+func graphQL(ctx context.Context, client *github.Client, query string, vars map[string]any, out any) error {
+	req, err := client.NewRequest("POST", "graphql", map[string]any{
+		"query":     query,
+		"variables": vars,
+	})
+	if err != nil {
+		return err
+	}
+
+	var resp struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if _, err := client.Do(ctx, req, &resp); err != nil {
+		return err
+	}
+	if len(resp.Errors) > 0 {
+		return fmt.Errorf("graphql: %s", resp.Errors[0].Message)
+	}
+	return json.Unmarshal(resp.Data, out)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Review checkouts authenticate with the same tokens as the API, so private
+// repos work with per-org tokens and without `gh auth`. The review script
+// points git at `pr-monitor git-credential` for github.com only (replacing any
+// other helper for it, such as a gh login for an account without access to
+// the org), which answers with the token configured for the repo's owner.
+
+const gitCredentialHost = "github.com"
+
+// gitCredentialHelper is the credential.helper value that runs exe as the
+// helper.
+func gitCredentialHelper(exe string) string {
+	return "!" + shellQuote(exe) + " git-credential"
+}
+
+// shellQuote quotes s for sh. It's only used for our own executable's path,
+// which git runs through the shell; PR data never goes near a shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func tokenForOrg(org string) string {
+	if token, ok := config.OrgTokens[org]; ok {
+		return token
+	}
+	return config.GitHubToken
+}
+
+func runGitCredential(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: pr-monitor git-credential get")
+	}
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	return gitCredential(args[0], os.Stdin, os.Stdout)
+}
+
+// gitCredential implements the credential helper protocol. Only get is
+// answered; there's nothing to store or erase.
+func gitCredential(op string, in io.Reader, out io.Writer) error {
+	attrs := make(map[string]string)
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		if k, v, ok := strings.Cut(line, "="); ok {
+			attrs[k] = v
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	if op != "get" || attrs["protocol"] != "https" || attrs["host"] != gitCredentialHost {
+		return nil
+	}
+	owner, _, _ := strings.Cut(attrs["path"], "/")
+	token := tokenForOrg(owner)
+	if owner == "" || token == "" {
+		return nil
+	}
+	_, err := fmt.Fprintf(out, "username=x-access-token\npassword=%s\n", token)
+	return err
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// Handing off PRs you can't get to: "Reassign to…" requests a review from a
+// teammate (one of the configured authors or handoff.teams) and withdraws
+// your own request, and "Nudge Author" comments on a PR whose approval went
+// stale with new commits, asking the author to re-request review when it's
+// ready. Both are logged in pr_actions with the PR's head commit, and the
+// refresh, notification and recheck paths leave the PR off the list while
+// handedOff holds: until review is re-requested or new commits arrive.
+
+const (
+	actionReassign = "reassign"
+	actionNudge    = "nudge"
+)
+
+const defaultNudgeMessage = `@{{.Author}} there are new commits since this was approved. Please re-request my review when it's ready for another look.`
+
+type HandoffConfig struct {
+	Teams        []string `yaml:"teams"` // org/team-slug
+	NudgeMessage string   `yaml:"nudge_message"`
+}
+
+// prAction is an entry in the pr_actions log.
+type prAction struct {
+	Repo      string
+	Number    int
+	Action    string // reassign or nudge
+	Target    string // the new reviewer, or the author nudged
+	HeadSHA   string
+	CreatedAt time.Time
+}
+
+func validateHandoffConfig() error {
+	for _, team := range config.Handoff.Teams {
+		if org, slug, ok := strings.Cut(team, "/"); !ok || org == "" || slug == "" {
+			return fmt.Errorf("handoff.teams: invalid team %q, expected org/team-slug", team)
+		}
+	}
+	if _, err := nudgeTemplate(); err != nil {
+		return fmt.Errorf("handoff.nudge_message: %w", err)
+	}
+	return nil
+}
+
+func nudgeTemplate() (*template.Template, error) {
+	text := config.Handoff.NudgeMessage
+	if text == "" {
+		text = defaultNudgeMessage
+	}
+	return template.New("nudge").Parse(text)
+}
+
+// reassignTargets lists who a PR in repo by author can be handed to: the
+// other configured authors, then teams in the repo's org.
+func reassignTargets(repo, author string) []string {
+	owner, _ := parseRepo(repo)
+	var targets []string
+	for _, a := range config.Authors {
+		if a != author && a != currentUser {
+			targets = append(targets, a)
+		}
+	}
+	for _, team := range config.Handoff.Teams {
+		if org, _, _ := strings.Cut(team, "/"); org == owner {
+			targets = append(targets, team)
+		}
+	}
+	return targets
+}
+
+// reassignPR requests a review from target (a login or org/team-slug) and
+// removes the current user's own request.
+func reassignPR(ctx context.Context, repo string, number int, target string) error {
+	owner, repoName := parseRepo(repo)
+	client := getClientForOrg(owner)
+	if client == nil {
+		return fmt.Errorf("no client available for %s", repo)
+	}
+
+	ghPR, _, err := client.PullRequests.Get(ctx, owner, repoName, number)
+	if err != nil {
+		return fmt.Errorf("fetching PR: %w", err)
+	}
+
+	var req github.ReviewersRequest
+	if org, slug, isTeam := strings.Cut(target, "/"); isTeam {
+		if org != owner {
+			return fmt.Errorf("team %s isn't in %s's org", target, repo)
+		}
+		req.TeamReviewers = []string{slug}
+	} else {
+		req.Reviewers = []string{target}
+	}
+	if _, _, err := client.PullRequests.RequestReviewers(ctx, owner, repoName, number, req); err != nil {
+		return fmt.Errorf("requesting review from %s: %w", target, err)
+	}
+
+	// A request made through one of your teams isn't yours to withdraw
+	if isReviewRequestedForUser(ghPR) {
+		if _, err := client.PullRequests.RemoveReviewers(ctx, owner, repoName, number, github.ReviewersRequest{Reviewers: []string{currentUser}}); err != nil {
+			return fmt.Errorf("removing your review request: %w", err)
+		}
+	}
+
+	return recordAction(ctx, client, ghPR, repo, actionReassign, target)
+}
+
+// nudgeAuthor comments on the PR with the nudge message, or message if set.
+func nudgeAuthor(ctx context.Context, repo string, number int, message string) error {
+	owner, repoName := parseRepo(repo)
+	client := getClientForOrg(owner)
+	if client == nil {
+		return fmt.Errorf("no client available for %s", repo)
+	}
+
+	ghPR, _, err := client.PullRequests.Get(ctx, owner, repoName, number)
+	if err != nil {
+		return fmt.Errorf("fetching PR: %w", err)
+	}
+
+	if message == "" {
+		tmpl, err := nudgeTemplate()
+		if err != nil {
+			return err
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, PRInfo{
+			Repo:   repo,
+			Number: number,
+			Title:  ghPR.GetTitle(),
+			Author: ghPR.GetUser().GetLogin(),
+			URL:    ghPR.GetHTMLURL(),
+		}); err != nil {
+			return fmt.Errorf("rendering nudge_message: %w", err)
+		}
+		message = b.String()
+	}
+
+	if _, _, err := client.Issues.CreateComment(ctx, owner, repoName, number, &github.IssueComment{Body: github.String(message)}); err != nil {
+		return fmt.Errorf("posting comment: %w", err)
+	}
+
+	return recordAction(ctx, client, ghPR, repo, actionNudge, ghPR.GetUser().GetLogin())
+}
+
+// recordAction logs an action taken on ghPR and rechecks it so the list
+// reflects it straight away.
+func recordAction(ctx context.Context, client *github.Client, ghPR *github.PullRequest, repo, action, target string) error {
+	number := ghPR.GetNumber()
+	uiLog().Info("PR action", prAttr(repo, number), "action", action, "target", target)
+	if err := store.RecordAction(prAction{
+		Repo:      repo,
+		Number:    number,
+		Action:    action,
+		Target:    target,
+		HeadSHA:   ghPR.GetHead().GetSHA(),
+		CreatedAt: clock.Now(),
+	}); err != nil {
+		return fmt.Errorf("logging %s: %w", action, err)
+	}
+
+	owner, repoName := parseRepo(repo)
+	authorSet := make(map[string]bool)
+	for _, a := range config.Authors {
+		authorSet[a] = true
+	}
+	recheckPR(ctx, client, owner, repoName, repo, number, authorSet)
+	return nil
+}
+
+// handedOff reports whether the latest action on ghPR still applies: it was
+// taken at the current head commit and review hasn't been re-requested.
+func handedOff(repo string, ghPR *github.PullRequest) (prAction, bool) {
+	if isReviewRequestedForUser(ghPR) {
+		return prAction{}, false
+	}
+	a, ok := store.LatestAction(repo, ghPR.GetNumber())
+	if !ok || a.HeadSHA == "" || a.HeadSHA != ghPR.GetHead().GetSHA() {
+		return prAction{}, false
+	}
+	return a, true
+}
+
+func (s *sqliteStore) RecordAction(a prAction) error {
+	_, err := s.db.Exec(`
+		INSERT INTO pr_actions (repo, number, action, target, head_sha, created_at) VALUES (?, ?, ?, ?, ?, ?)
+	`, a.Repo, a.Number, a.Action, a.Target, a.HeadSHA, a.CreatedAt.UTC().Format(time.RFC3339))
+	return err
+}
+
+func (s *sqliteStore) LatestAction(repo string, number int) (prAction, bool) {
+	a := prAction{Repo: repo, Number: number}
+	var ts string
+	err := s.db.QueryRow(`
+		SELECT action, target, head_sha, created_at FROM pr_actions
+		WHERE repo = ? AND number = ? ORDER BY id DESC LIMIT 1
+	`, repo, number).Scan(&a.Action, &a.Target, &a.HeadSHA, &ts)
+	if err != nil {
+		return prAction{}, false
+	}
+	a.CreatedAt, _ = time.Parse(time.RFC3339, ts)
+	return a, true
+}
+
+// handoffFromMenu runs a reassign or nudge clicked in the tray.
+func handoffFromMenu(pr PRInfo, action, target string) {
+	ctx, cancel := context.WithTimeout(appCtx, 30*time.Second)
+	defer cancel()
+
+	var err error
+	if action == actionReassign {
+		err = reassignPR(ctx, pr.Repo, pr.Number, target)
+	} else {
+		err = nudgeAuthor(ctx, pr.Repo, pr.Number, "")
+	}
+	if err != nil {
+		uiLog().Error("PR action failed", prAttr(pr.Repo, pr.Number), "action", action, "err", err)
+	}
+}
+
+func runReassign(args []string) error {
+	fs := flag.NewFlagSet("reassign", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("usage: pr-monitor reassign owner/repo#123 login|org/team")
+	}
+	repo, number, err := parsePRRef(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if err := openClientsForCommand(); err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := reassignPR(ctx, repo, number, fs.Arg(1)); err != nil {
+		return err
+	}
+	fmt.Printf("Requested review from %s on %s#%d\n", fs.Arg(1), repo, number)
+	return nil
+}
+
+func runNudge(args []string) error {
+	fs := flag.NewFlagSet("nudge", flag.ContinueOnError)
+	message := fs.String("m", "", "comment to post instead of handoff.nudge_message")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: pr-monitor nudge [-m message] owner/repo#123")
+	}
+	repo, number, err := parsePRRef(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if err := openClientsForCommand(); err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := nudgeAuthor(ctx, repo, number, *message); err != nil {
+		return err
+	}
+	fmt.Printf("Nudged the author of %s#%d\n", repo, number)
+	return nil
+}
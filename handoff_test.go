@@ -0,0 +1,130 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func withHead(sha string) func(*github.PullRequest) {
+	return func(pr *github.PullRequest) {
+		pr.Head = &github.PullRequestBranch{SHA: github.String(sha)}
+	}
+}
+
+func TestReassignPR(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.addPR(7, "alice", requested("me"), withHead("abc"))
+	store.SavePR(PRInfo{Repo: "acme/api", Number: 7, Author: "alice", NeedsReview: true, Reason: reasonDirect})
+
+	if err := reassignPR(t.Context(), "acme/api", 7, "bob"); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, u := range gh.pulls["acme/api#7"].RequestedReviewers {
+		got = append(got, u.GetLogin())
+	}
+	if !slices.Equal(got, []string{"bob"}) {
+		t.Errorf("requested reviewers = %v, want bob instead of me", got)
+	}
+	if a, ok := store.LatestAction("acme/api", 7); !ok || a.Action != actionReassign || a.Target != "bob" || a.HeadSHA != "abc" {
+		t.Errorf("logged action = %+v, %v; want reassign to bob at abc", a, ok)
+	}
+	refreshAllRepos(t.Context())
+	if got := prNumbers(t); len(got) != 0 {
+		t.Fatalf("listed PRs = %v, want the reassigned PR hidden", got)
+	}
+
+	// New commits bring it back
+	gh.update(7, withHead("def"))
+	refreshAllRepos(t.Context())
+	if got := prNumbers(t); len(got) != 1 || got[0] != 7 {
+		t.Errorf("listed PRs = %v, want [7] back after new commits", got)
+	}
+}
+
+func TestReassignToTeam(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.addPR(7, "alice", withHead("abc"))
+
+	if err := reassignPR(t.Context(), "acme/api", 7, "other/backend"); err == nil {
+		t.Error("reassigning to a team in another org should fail")
+	}
+	if err := reassignPR(t.Context(), "acme/api", 7, "acme/backend"); err != nil {
+		t.Fatal(err)
+	}
+	if teams := gh.pulls["acme/api#7"].RequestedTeams; len(teams) != 1 || teams[0].GetSlug() != "backend" {
+		t.Errorf("requested teams = %v, want backend", teams)
+	}
+	if n := gh.requestCount("DELETE", "/repos/acme/api/pulls/7/requested_reviewers"); n != 0 {
+		t.Errorf("removed reviewers %d times; there was no request of mine to withdraw", n)
+	}
+}
+
+func TestNudgeAuthor(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.addPR(7, "alice", withHead("abc"))
+	gh.addReview(7, "me", "APPROVED", testNow.Add(-2*time.Hour))
+	gh.addCommit(7, testNow.Add(-time.Hour))
+	store.SavePR(PRInfo{Repo: "acme/api", Number: 7, Author: "alice", NeedsReapproval: true})
+
+	if err := nudgeAuthor(t.Context(), "acme/api", 7, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	comments := gh.comments["acme/api#7"]
+	if len(comments) != 1 || !strings.HasPrefix(comments[0].GetBody(), "@alice there are new commits") {
+		t.Errorf("comments = %v, want the default nudge for alice", comments)
+	}
+	if a, ok := store.LatestAction("acme/api", 7); !ok || a.Action != actionNudge || a.Target != "alice" {
+		t.Errorf("logged action = %+v, %v; want a nudge to alice", a, ok)
+	}
+	if active, _ := store.LoadActivePRs(); len(active) != 0 {
+		t.Errorf("active PRs = %v, want the nudged PR hidden while waiting on the author", active)
+	}
+	if store.IsMuted("acme/api", 7) {
+		t.Error("a nudge shouldn't mute the PR; new commits need to bring it back")
+	}
+}
+
+func TestNudgeMessageTemplate(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.addPR(7, "alice", withHead("abc"))
+	config.Handoff.NudgeMessage = "Ping @{{.Author}} about {{.Repo}}#{{.Number}}"
+
+	if err := nudgeAuthor(t.Context(), "acme/api", 7, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := gh.comments["acme/api#7"]; len(got) != 1 || got[0].GetBody() != "Ping @alice about acme/api#7" {
+		t.Errorf("comments = %v", got)
+	}
+}
+
+func TestReassignTargets(t *testing.T) {
+	setupTest(t)
+	config.Authors = []string{"alice", "bob", "me"}
+	config.Handoff.Teams = []string{"acme/backend", "other/web"}
+
+	got := reassignTargets("acme/api", "alice")
+	if want := []string{"bob", "acme/backend"}; !slices.Equal(got, want) {
+		t.Errorf("targets = %v, want %v (not the author, me, or other orgs' teams)", got, want)
+	}
+}
+
+func TestValidateHandoffConfig(t *testing.T) {
+	setupTest(t)
+	for _, h := range []HandoffConfig{
+		{Teams: []string{"backend"}},
+		{Teams: []string{"acme/"}},
+		{NudgeMessage: "{{.Author"},
+	} {
+		config.Handoff = h
+		if err := validateHandoffConfig(); err == nil {
+			t.Errorf("%+v should be invalid", h)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+	"golang.org/x/oauth2"
+)
+
+// Full refreshes re-list every repo's PRs and each PR's reviews and commits.
+// etagTransport keeps those responses in SQLite and revalidates them with
+// If-None-Match, so resources that haven't changed come back as 304 Not
+// Modified, which GitHub doesn't count against the rate limit. The cached
+// body is then handed to go-github as if it were a normal 200.
+
+// httpCacheRetention is how long a cached response survives without being used.
+const httpCacheRetention = 14 * 24 * time.Hour
+
+// cacheablePath matches PR listings, reviews and commits. The prefix is left
+// open so GitHub Enterprise's /api/v3 base path matches too.
+var cacheablePath = regexp.MustCompile(`/repos/[^/]+/[^/]+/pulls(/\d+/(reviews|commits))?$`)
+
+type cachedResponse struct {
+	ETag   string
+	Header http.Header
+	Body   []byte
+}
+
+// cachedHeaders are kept with the body; everything else (rate limit headers
+// in particular) comes from the live 304.
+var cachedHeaders = []string{"Content-Type", "Link"}
+
+type etagTransport struct {
+	base http.RoundTripper
+	// scope separates cache entries per token, since different tokens may
+	// see different results for the same URL
+	scope string
+}
+
+// newGitHubClient returns a client authenticated with token whose cacheable
+// requests go through etagTransport. name identifies the token in diagnostics.
+func newGitHubClient(ctx context.Context, name, token string) *github.Client {
+	httpClient := oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}))
+	sum := sha256.Sum256([]byte(token))
+	httpClient.Transport = &etagTransport{
+		base:  &tokenObserver{base: httpClient.Transport, name: name},
+		scope: hex.EncodeToString(sum[:8]),
+	}
+	return github.NewClient(httpClient)
+}
+
+func (t *etagTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if store == nil || req.Method != http.MethodGet || !cacheablePath.MatchString(req.URL.Path) ||
+		req.Header.Get("If-None-Match") != "" || req.Header.Get("If-Modified-Since") != "" {
+		return t.base.RoundTrip(req)
+	}
+
+	key := t.scope + " " + req.Header.Get("Accept") + " " + req.URL.String()
+	cached, ok := store.CachedResponse(key)
+	if ok {
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", cached.ETag)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case ok && resp.StatusCode == http.StatusNotModified:
+		resp.Body.Close()
+		githubLog().Debug("Serving cached response", "path", req.URL.Path)
+		if err := store.TouchCachedResponse(key, clock.Now()); err != nil {
+			githubLog().Warn("Failed to update HTTP cache entry", "err", err)
+		}
+		for _, h := range cachedHeaders {
+			if v, ok := cached.Header[h]; ok {
+				resp.Header[h] = v
+			}
+		}
+		resp.StatusCode = http.StatusOK
+		resp.Status = "200 OK"
+		resp.Body = io.NopCloser(bytes.NewReader(cached.Body))
+		resp.ContentLength = int64(len(cached.Body))
+		return resp, nil
+
+	case resp.StatusCode == http.StatusOK && resp.Header.Get("ETag") != "":
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+
+		entry := cachedResponse{ETag: resp.Header.Get("ETag"), Header: http.Header{}, Body: body}
+		for _, h := range cachedHeaders {
+			if v, ok := resp.Header[h]; ok {
+				entry.Header[h] = v
+			}
+		}
+		if err := store.SaveCachedResponse(key, entry, clock.Now()); err != nil {
+			githubLog().Warn("Failed to cache response", "path", req.URL.Path, "err", err)
+		}
+	}
+
+	return resp, nil
+}
+
+func (s *sqliteStore) CachedResponse(key string) (cachedResponse, bool) {
+	var r cachedResponse
+	var header string
+	err := s.db.QueryRow("SELECT etag, header, body FROM http_cache WHERE key = ?", key).Scan(&r.ETag, &header, &r.Body)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			githubLog().Warn("Failed to read HTTP cache", "err", err)
+		}
+		return r, false
+	}
+	if err := json.Unmarshal([]byte(header), &r.Header); err != nil {
+		return r, false
+	}
+	return r, true
+}
+
+func (s *sqliteStore) SaveCachedResponse(key string, r cachedResponse, now time.Time) error {
+	header, err := json.Marshal(r.Header)
+	if err != nil {
+		return err
+	}
+	if r.Body == nil {
+		r.Body = []byte{} // nil would be stored as NULL
+	}
+	_, err = s.db.Exec(`
+		INSERT INTO http_cache (key, etag, header, body, used_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			etag = excluded.etag, header = excluded.header, body = excluded.body, used_at = excluded.used_at
+	`, key, r.ETag, string(header), r.Body, now.UTC().Format(time.RFC3339))
+	return err
+}
+
+func (s *sqliteStore) TouchCachedResponse(key string, now time.Time) error {
+	_, err := s.db.Exec("UPDATE http_cache SET used_at = ? WHERE key = ?", now.UTC().Format(time.RFC3339), key)
+	return err
+}
+
+// PruneHTTPCache drops entries not used since before, e.g. for closed PRs.
+func (s *sqliteStore) PruneHTTPCache(before time.Time) error {
+	_, err := s.db.Exec("DELETE FROM http_cache WHERE used_at < ?", before.UTC().Format(time.RFC3339))
+	return err
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRefreshRevalidatesWithETags(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.addPR(1, "alice")
+	gh.addReview(1, "carol", "APPROVED", testNow.Add(-30*time.Minute))
+	gh.addCommit(1, testNow.Add(-10*time.Minute))
+
+	refreshAllRepos(t.Context())
+	if gh.notModified != 0 {
+		t.Fatalf("%d responses were 304 on a cold cache", gh.notModified)
+	}
+
+	// Nothing changed: the listing, reviews and commits all come from the cache
+	refreshAllRepos(t.Context())
+	gh.mu.Lock()
+	notModified := gh.notModified
+	gh.mu.Unlock()
+	if notModified != 3 {
+		t.Errorf("%d responses were 304, want 3", notModified)
+	}
+	if got := prNumbers(t); len(got) != 1 || !prs[0].NeedsReapproval {
+		t.Fatalf("listed PRs = %v, want [1] needing re-approval from cached responses", got)
+	}
+
+	// A change invalidates the cached reviews
+	gh.addReview(1, "carol", "APPROVED", testNow)
+	refreshAllRepos(t.Context())
+	if got := prNumbers(t); len(got) != 0 {
+		t.Errorf("listed PRs = %v after re-approval, want none", got)
+	}
+}
+
+func TestHTTPCachePrune(t *testing.T) {
+	setupTest(t)
+
+	if err := store.SaveCachedResponse("old", cachedResponse{ETag: `"a"`}, testNow.Add(-2*httpCacheRetention)); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveCachedResponse("new", cachedResponse{ETag: `"b"`}, testNow); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PruneHTTPCache(testNow.Add(-httpCacheRetention)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := store.CachedResponse("old"); ok {
+		t.Error("stale entry survived pruning")
+	}
+	if _, ok := store.CachedResponse("new"); !ok {
+		t.Error("recent entry was pruned")
+	}
+}
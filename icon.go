@@ -7,29 +7,28 @@ import (
 	"image/png"
 )
 
-var (
-	// Cache icons to avoid regenerating
-	iconNormal []byte
-	iconAlert  []byte
-)
+// Cache icons to avoid regenerating, indexed by [hasAlert][hasError]
+var icons [2][2][]byte
 
 func init() {
-	iconNormal = generateIconWithAlert(false)
-	iconAlert = generateIconWithAlert(true)
+	for _, alert := range []bool{false, true} {
+		for _, problem := range []bool{false, true} {
+			icons[boolToInt(alert)][boolToInt(problem)] = generateIcon(alert, problem)
+		}
+	}
 }
 
-// getIcon returns the appropriate icon based on whether there are PRs needing attention
-func getIcon(hasAlerts bool) []byte {
-	if hasAlerts {
-		return iconAlert
-	}
-	return iconNormal
+// getIcon returns the appropriate icon based on whether there are PRs needing
+// attention and whether diagnostics found problems
+func getIcon(hasAlerts, hasProblems bool) []byte {
+	return icons[boolToInt(hasAlerts)][boolToInt(hasProblems)]
 }
 
-// generateIconWithAlert creates a PR icon for the menu bar
+// generateIcon creates a PR icon for the menu bar
 // Uses white color for visibility on dark menu bars
-// Adds a red notification dot when hasAlert is true
-func generateIconWithAlert(hasAlert bool) []byte {
+// Adds a red notification dot when hasAlert is true, and an amber
+// badge in the bottom-left corner when hasProblem is true
+func generateIcon(hasAlert, hasProblem bool) []byte {
 	const size = 22
 	img := image.NewRGBA(image.Rect(0, 0, size, size))
 
@@ -75,6 +74,11 @@ func generateIconWithAlert(hasAlert bool) []byte {
 		drawCircle(img, 15, 6, 8, red)
 	}
 
+	if hasProblem {
+		amber := color.RGBA{255, 179, 0, 255}
+		drawCircle(img, 5, 17, 4, amber)
+	}
+
 	var buf bytes.Buffer
 	if err := png.Encode(&buf, img); err != nil {
 		return nil
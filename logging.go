@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Logs go to stderr and to pr-monitor.log in configDir, which survives being
+// launched from a login item. The file is rotated by size, keeping a few old
+// generations next to it (pr-monitor.log.1 is the most recent).
+
+const (
+	logFileName    = "pr-monitor.log"
+	logMaxSize     = 5 << 20
+	logGenerations = 3
+)
+
+var logLevel = new(slog.LevelVar)
+
+// setupLogging installs the default slog logger for the tray app. Until the
+// config is loaded the level is info; main then applies log_level.
+func setupLogging() {
+	var w io.Writer = os.Stderr
+	file, err := openRotatingFile(logPath(), logMaxSize, logGenerations)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: logging to stderr only, couldn't open %s: %v\n", logPath(), err)
+	} else {
+		w = io.MultiWriter(os.Stderr, file)
+	}
+
+	slog.SetDefault(slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: logLevel})))
+}
+
+func logPath() string {
+	return filepath.Join(configDir, logFileName)
+}
+
+// parseLogLevel accepts debug, info, warn or error; empty means info.
+func parseLogLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("invalid log_level %q: expected debug, info, warn or error", s)
+}
+
+// Subsystem loggers. They're functions rather than package variables so they
+// pick up the handler installed by setupLogging.
+
+func pollerLog() *slog.Logger  { return slog.With("subsystem", "poller") }
+func recheckLog() *slog.Logger { return slog.With("subsystem", "recheck") }
+func dbLog() *slog.Logger      { return slog.With("subsystem", "db") }
+func syncLog() *slog.Logger    { return slog.With("subsystem", "sync") }
+func webhookLog() *slog.Logger { return slog.With("subsystem", "webhook") }
+func metricsLog() *slog.Logger { return slog.With("subsystem", "metrics") }
+func githubLog() *slog.Logger  { return slog.With("subsystem", "github") }
+func uiLog() *slog.Logger      { return slog.With("subsystem", "ui") }
+
+// prAttr identifies a PR in log records.
+func prAttr(repo string, number int) slog.Attr {
+	return slog.String("pr", fmt.Sprintf("%s#%d", repo, number))
+}
+
+// rotatingFile is an append-only log file that's renamed to path.1 (shifting
+// older generations up) once it grows past maxSize.
+type rotatingFile struct {
+	mu          sync.Mutex
+	path        string
+	maxSize     int64
+	generations int
+	file        *os.File
+	size        int64
+}
+
+func openRotatingFile(path string, maxSize int64, generations int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, generations: generations}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.file, r.size = f, info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) rotate() error {
+	r.file.Close()
+	for i := r.generations - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil {
+		return err
+	}
+	return r.open()
+}
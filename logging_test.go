@@ -0,0 +1,83 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRotatingFileKeepsGenerations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	r, err := openRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.file.Close() })
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := map[string]string{
+		path:        "fourth\n",
+		path + ".1": "third\n",
+		path + ".2": "second\n",
+	}
+	for p, content := range want {
+		got, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("%s = %q, want %q", filepath.Base(p), got, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected only 2 old generations, found %s.3", filepath.Base(path))
+	}
+}
+
+func TestRotatingFileAppendsToExisting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	if err := os.WriteFile(path, []byte("12345678"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r, err := openRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.file.Close() })
+
+	// Counts the existing size, so this write goes to a fresh file
+	if _, err := r.Write([]byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path + ".1"); string(got) != "12345678" {
+		t.Errorf("rotated file = %q, want the original contents", got)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "abc" {
+		t.Errorf("log file = %q, want %q", got, "abc")
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	for s, want := range map[string]slog.Level{
+		"":      slog.LevelInfo,
+		"debug": slog.LevelDebug,
+		"WARN":  slog.LevelWarn,
+		"error": slog.LevelError,
+	} {
+		got, err := parseLogLevel(s)
+		if err != nil || got != want {
+			t.Errorf("parseLogLevel(%q) = %v, %v; want %v", s, got, err, want)
+		}
+	}
+
+	if _, err := parseLogLevel("verbose"); err == nil || !strings.Contains(err.Error(), "log_level") {
+		t.Errorf("parseLogLevel(verbose) error = %v, want an invalid log_level error", err)
+	}
+}
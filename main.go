@@ -4,18 +4,16 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"runtime"
-	"sort"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/getlantern/systray"
 	"github.com/google/go-github/v57/github"
-	"golang.org/x/oauth2"
 	"gopkg.in/yaml.v3"
 )
 
@@ -28,6 +26,31 @@ type Config struct {
 	Repos               []string          `yaml:"repos"`
 	Authors             []string          `yaml:"authors"`
 	FullRefreshInterval time.Duration     `yaml:"full_refresh_interval"`
+	RefreshConcurrency  int               `yaml:"refresh_concurrency"`
+	OrgConcurrency      map[string]int    `yaml:"org_concurrency"`
+	LogLevel            string            `yaml:"log_level"`
+	NotificationMode    string            `yaml:"notification_mode"`
+	Sync                SyncConfig        `yaml:"sync"`
+	Reasons             ReasonConfig      `yaml:"reasons"`
+	Webhook             WebhookConfig     `yaml:"webhook"`
+	Metrics             MetricsConfig     `yaml:"metrics"`
+	Review              ReviewConfig      `yaml:"review"`
+	Preview             PreviewConfig     `yaml:"preview"`
+	Handoff             HandoffConfig     `yaml:"handoff"`
+	Open                OpenConfig        `yaml:"open"`
+}
+
+// ReasonConfig controls how PRs are surfaced depending on why they're on the
+// list: direct, team, mention or other.
+type ReasonConfig struct {
+	Silent []string `yaml:"silent"`
+	Hidden []string `yaml:"hidden"`
+}
+
+type SyncConfig struct {
+	Dir      string        `yaml:"dir"`
+	Device   string        `yaml:"device"`
+	Interval time.Duration `yaml:"interval"`
 }
 
 type PRInfo struct {
@@ -38,6 +61,8 @@ type PRInfo struct {
 	URL             string
 	NeedsReview     bool
 	NeedsReapproval bool
+	FollowUp        bool
+	Reason          string
 }
 
 func (pr PRInfo) Key() string {
@@ -47,17 +72,30 @@ func (pr PRInfo) Key() string {
 type PRMenuItem struct {
 	parent   *systray.MenuItem
 	open     *systray.MenuItem
+	files    *systray.MenuItem
+	unread   *systray.MenuItem
 	ignore   *systray.MenuItem
 	reviewed *systray.MenuItem
 	review   *systray.MenuItem
+	preview  *systray.MenuItem
+	approve  *systray.MenuItem // confirmation under "Quick Approve"
+
+	reassignMenu *systray.MenuItem
+	reassign     []reassignItem
+	nudgeMenu    *systray.MenuItem
+	nudge        *systray.MenuItem // confirmation under "Nudge Author"
+}
+
+// reassignItem is one teammate or team under "Reassign to…".
+type reassignItem struct {
+	target string
+	item   *systray.MenuItem
 }
 
 var (
 	config        Config
 	configDir     string
 	currentUser   string
-	defaultClient *github.Client
-	orgClients    map[string]*github.Client
 	prs           []PRInfo
 	prsMutex      sync.RWMutex
 	menuItems     []PRMenuItem
@@ -72,28 +110,43 @@ func main() {
 	}
 	configDir = filepath.Join(home, ".config", "pr-monitor")
 
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(os.Args[1:]))
+	}
+
+	setupLogging()
+
 	if err := loadConfig(); err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		slog.Error("Failed to load config", "err", err)
+		os.Exit(1)
 	}
+	level, _ := parseLogLevel(config.LogLevel)
+	logLevel.Set(level)
 
 	if err := openDB(); err != nil {
-		log.Fatalf("Failed to open database: %v", err)
+		dbLog().Error("Failed to open database", "err", err)
+		os.Exit(1)
 	}
 
 	if err := importIgnoredJSON(); err != nil {
-		log.Printf("Warning: Failed to import ignored.json: %v", err)
+		dbLog().Warn("Failed to import ignored.json", "err", err)
 	}
 
+	diag.load()
+
+	initSync()
+
 	initClients()
 
 	// Load cached PRs from DB for instant startup
-	if cached, err := dbLoadActivePRs(); err == nil && len(cached) > 0 {
+	if cached, err := store.LoadActivePRs(); err == nil && len(cached) > 0 {
 		prsMutex.Lock()
-		prs = cached
+		prs = visiblePRs(cached)
 		prsMutex.Unlock()
-		log.Printf("Loaded %d cached PRs from database", len(cached))
+		dbLog().Info("Loaded cached PRs from database", "count", len(cached))
 	}
 
+	handleSignals()
 	systray.Run(onReady, onExit)
 }
 
@@ -122,6 +175,14 @@ func loadConfig() error {
 		config.MaxAgeDays = 3
 	}
 
+	switch config.NotificationMode {
+	case "":
+		config.NotificationMode = notificationModeMarkRead
+	case notificationModeMarkRead, notificationModePreserve:
+	default:
+		return fmt.Errorf("invalid notification_mode %q: expected %s or %s", config.NotificationMode, notificationModeMarkRead, notificationModePreserve)
+	}
+
 	if len(config.Repos) == 0 {
 		return fmt.Errorf("no repositories configured")
 	}
@@ -136,56 +197,113 @@ func loadConfig() error {
 		}
 	}
 
+	if config.RefreshConcurrency < 0 {
+		return fmt.Errorf("invalid refresh_concurrency %d: must be positive", config.RefreshConcurrency)
+	}
+	for org, n := range config.OrgConcurrency {
+		if n < 1 {
+			return fmt.Errorf("invalid org_concurrency for %s: %d must be positive", org, n)
+		}
+	}
+
+	if _, err := parseLogLevel(config.LogLevel); err != nil {
+		return err
+	}
+
+	if config.Webhook.Listen != "" && config.Webhook.Secret == "" {
+		return fmt.Errorf("webhook.secret is required when webhook.listen is set")
+	}
+
+	if err := validateReasons(config.Reasons.Silent); err != nil {
+		return fmt.Errorf("reasons.silent: %w", err)
+	}
+	if err := validateReasons(config.Reasons.Hidden); err != nil {
+		return fmt.Errorf("reasons.hidden: %w", err)
+	}
+
+	if err := validateReviewConfig(); err != nil {
+		return err
+	}
+	if err := validateHandoffConfig(); err != nil {
+		return err
+	}
+	if err := validateOpenConfig(); err != nil {
+		return err
+	}
+	if err := validatePreviewConfig(); err != nil {
+		return err
+	}
+
 	return nil
 }
 
+// GitHubClients hands out authenticated API clients: the default client (from
+// github_token) for notifications, and per-org clients for repo access.
+type GitHubClients interface {
+	Default() *github.Client
+	ForOrg(org string) *github.Client
+}
+
+var clients GitHubClients
+
+type tokenClients struct {
+	defaultClient *github.Client
+	orgClients    map[string]*github.Client
+}
+
+func (c *tokenClients) Default() *github.Client {
+	return c.defaultClient
+}
+
+func (c *tokenClients) ForOrg(org string) *github.Client {
+	if client, ok := c.orgClients[org]; ok {
+		return client
+	}
+	return c.defaultClient
+}
+
 func initClients() {
 	ctx := context.Background()
-	orgClients = make(map[string]*github.Client)
+	tc := &tokenClients{orgClients: make(map[string]*github.Client)}
 
 	if config.GitHubToken != "" {
-		ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: config.GitHubToken})
-		tc := oauth2.NewClient(ctx, ts)
-		defaultClient = github.NewClient(tc)
+		tc.defaultClient = newGitHubClient(ctx, defaultTokenName, config.GitHubToken)
 	}
 
 	for org, token := range config.OrgTokens {
-		ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
-		tc := oauth2.NewClient(ctx, ts)
-		orgClients[org] = github.NewClient(tc)
+		tc.orgClients[org] = newGitHubClient(ctx, org, token)
 	}
 
-	if defaultClient == nil && len(orgClients) == 0 {
-		log.Fatal("No GitHub tokens configured. Set github_token or org_tokens in config.")
+	if tc.defaultClient == nil && len(tc.orgClients) == 0 {
+		githubLog().Error("No GitHub tokens configured. Set github_token or org_tokens in config.")
+		os.Exit(1)
 	}
+	clients = tc
 
-	if defaultClient != nil {
-		user, _, err := defaultClient.Users.Get(ctx, "")
+	if tc.defaultClient != nil {
+		user, _, err := tc.defaultClient.Users.Get(ctx, "")
 		if err != nil {
-			log.Printf("Warning: failed to fetch authenticated user: %v", err)
+			githubLog().Warn("Failed to fetch authenticated user", "err", err)
 		} else {
 			currentUser = user.GetLogin()
-			log.Printf("Authenticated as %s", currentUser)
+			githubLog().Info("Authenticated", "user", currentUser)
 		}
 	}
 }
 
 func getClientForOrg(org string) *github.Client {
-	if client, ok := orgClients[org]; ok {
+	if client := clients.ForOrg(org); client != nil {
 		return client
 	}
-	if defaultClient != nil {
-		return defaultClient
-	}
-	log.Printf("Warning: No client available for org %s", org)
+	githubLog().Warn("No client available for org", "org", org)
 	return nil
 }
 
 func ignorePR(key string) {
 	repo, number := parsePRKey(key)
 	if repo != "" && number > 0 {
-		if err := dbIgnorePR(repo, number); err != nil {
-			log.Printf("Error ignoring PR %s: %v", key, err)
+		if err := store.IgnorePR(repo, number); err != nil {
+			uiLog().Error("Error ignoring PR", "pr", key, "err", err)
 		}
 	}
 
@@ -203,18 +321,18 @@ func ignorePR(key string) {
 }
 
 func clearIgnored() {
-	if err := dbClearIgnored(); err != nil {
-		log.Printf("Error clearing ignored PRs: %v", err)
+	if err := store.ClearIgnored(); err != nil {
+		uiLog().Error("Error clearing ignored PRs", "err", err)
 	}
 
-	go refreshAllRepos()
+	goBackground(func() { refreshAllRepos(appCtx) })
 }
 
 func mutePR(key string) {
 	repo, number := parsePRKey(key)
 	if repo != "" && number > 0 {
-		if err := dbMutePR(repo, number); err != nil {
-			log.Printf("Error muting PR %s: %v", key, err)
+		if err := store.MutePR(repo, number); err != nil {
+			uiLog().Error("Error muting PR", "pr", key, "err", err)
 		}
 	}
 
@@ -232,15 +350,15 @@ func mutePR(key string) {
 }
 
 func clearMuted() {
-	if err := dbClearMuted(); err != nil {
-		log.Printf("Error clearing muted PRs: %v", err)
+	if err := store.ClearMuted(); err != nil {
+		uiLog().Error("Error clearing muted PRs", "err", err)
 	}
 
-	go refreshAllRepos()
+	goBackground(func() { refreshAllRepos(appCtx) })
 }
 
 func onReady() {
-	systray.SetIcon(getIcon(false))
+	systray.SetIcon(getIcon(false, false))
 	systray.SetTitle("")
 
 	prsMutex.RLock()
@@ -256,11 +374,28 @@ func onReady() {
 	for i := 0; i < maxMenuItems; i++ {
 		parent := systray.AddMenuItem("", "")
 		open := parent.AddSubMenuItem("Open in Browser", "Open this PR in your browser")
+		files := parent.AddSubMenuItem("Open Files Changed", "Open this PR's diff")
+		unread := parent.AddSubMenuItem("Open First Unread Comment", "Jump to the first comment since you last opened this PR")
 		ignore := parent.AddSubMenuItem("Ignore", "Hide this PR permanently")
 		reviewed := parent.AddSubMenuItem("Mark as Reviewed", "Hide until review is re-requested")
-		review := parent.AddSubMenuItem("Review with Claude", "Clone and review this PR with Claude Code")
+		review := parent.AddSubMenuItem("Review Locally", "Check out this PR and open a review session in a terminal")
+		preview := parent.AddSubMenuItem("Preview", "Show the description, reviews and diff on a local page")
+		if !previewEnabled() {
+			preview.Hide()
+		}
+		approve := parent.AddSubMenuItem("Quick Approve", "Approve this PR on GitHub").AddSubMenuItem("Yes, approve", "Submit an approving review")
+		reassignMenu := parent.AddSubMenuItem("Reassign to…", "Request a review from someone else and withdraw yours")
+		var reassign []reassignItem
+		for _, target := range slices.Concat(config.Authors, config.Handoff.Teams) {
+			reassign = append(reassign, reassignItem{target, reassignMenu.AddSubMenuItem(target, "Request a review from "+target)})
+		}
+		nudgeMenu := parent.AddSubMenuItem("Nudge Author", "Ask the author to re-request review when the new commits are ready")
+		nudge := nudgeMenu.AddSubMenuItem("Yes, post comment", "Comment on the PR with handoff.nudge_message")
 		parent.Hide()
-		menuItems = append(menuItems, PRMenuItem{parent: parent, open: open, ignore: ignore, reviewed: reviewed, review: review})
+		menuItems = append(menuItems, PRMenuItem{
+			parent: parent, open: open, files: files, unread: unread, ignore: ignore, reviewed: reviewed, review: review, preview: preview, approve: approve,
+			reassignMenu: reassignMenu, reassign: reassign, nudgeMenu: nudgeMenu, nudge: nudge,
+		})
 	}
 
 	systray.AddSeparator()
@@ -270,6 +405,8 @@ func onReady() {
 	mClearMuted = systray.AddMenuItem("Clear Reviewed PRs", "Show all previously reviewed PRs again")
 	mClearMutedConfirm := mClearMuted.AddSubMenuItem("Yes, clear all reviewed PRs", "This cannot be undone")
 	mClearMuted.Hide()
+	addStatusMenu()
+	mOpenLog := systray.AddMenuItem("Open Log", "Open "+logFileName)
 	mQuit := systray.AddMenuItem("Quit", "Quit PR Monitor")
 
 	// If cached PRs were loaded, update the menu items now that they exist
@@ -278,26 +415,36 @@ func onReady() {
 	}
 
 	// Choose polling strategy based on notification access
-	if validateNotificationAccess() {
-		log.Println("Notification access confirmed — using notification-driven polling")
-		go notificationLoop()
-		go fullRefreshLoop()
+	if validateNotificationAccess(appCtx) {
+		pollerLog().Info("Notification access confirmed, using notification-driven polling")
+		diag.setPolling("notification polling")
+		goBackground(func() { notificationLoop(appCtx) })
+		goBackground(func() { fullRefreshLoop(appCtx) })
 	} else {
-		log.Println("Notification access unavailable — falling back to periodic polling")
-		go legacySchedulerLoop()
+		pollerLog().Warn("Notification access unavailable, falling back to periodic polling")
+		diag.setPolling("periodic refresh")
+		goBackground(func() { legacySchedulerLoop(appCtx) })
 	}
 
 	resumeRechecks()
 
+	if syncEnabled() {
+		goBackground(func() { syncLoop(appCtx) })
+	}
+
+	startHTTPServers(appCtx)
+
 	go func() {
 		for {
 			select {
 			case <-mRefresh.ClickedCh:
-				go refreshAllRepos()
+				goBackground(func() { refreshAllRepos(appCtx) })
 			case <-mClearConfirm.ClickedCh:
 				clearIgnored()
 			case <-mClearMutedConfirm.ClickedCh:
 				clearMuted()
+			case <-mOpenLog.ClickedCh:
+				openFile(logPath())
 			case <-mQuit.ClickedCh:
 				systray.Quit()
 			}
@@ -310,22 +457,50 @@ func onReady() {
 }
 
 func handlePRMenuClicks(index int, item PRMenuItem) {
+	for _, r := range item.reassign {
+		go func() {
+			for range r.item.ClickedCh {
+				prsMutex.RLock()
+				var pr PRInfo
+				if index < len(prs) {
+					pr = prs[index]
+				}
+				prsMutex.RUnlock()
+				if pr.Repo != "" {
+					goBackground(func() { handoffFromMenu(pr, actionReassign, r.target) })
+				}
+			}
+		}()
+	}
+
 	for {
 		select {
 		case <-item.parent.ClickedCh:
 			prsMutex.RLock()
 			if index < len(prs) {
 				pr := prs[index]
-				openURL(pr.URL)
-				go scheduleRecheck(pr)
+				goBackground(func() { openPR(pr, "") })
 			}
 			prsMutex.RUnlock()
 		case <-item.open.ClickedCh:
 			prsMutex.RLock()
 			if index < len(prs) {
 				pr := prs[index]
-				openURL(pr.URL)
-				go scheduleRecheck(pr)
+				goBackground(func() { openPR(pr, "") })
+			}
+			prsMutex.RUnlock()
+		case <-item.files.ClickedCh:
+			prsMutex.RLock()
+			if index < len(prs) {
+				pr := prs[index]
+				goBackground(func() { openPR(pr, linkFiles) })
+			}
+			prsMutex.RUnlock()
+		case <-item.unread.ClickedCh:
+			prsMutex.RLock()
+			if index < len(prs) {
+				pr := prs[index]
+				goBackground(func() { openPR(pr, linkUnread) })
 			}
 			prsMutex.RUnlock()
 		case <-item.ignore.ClickedCh:
@@ -356,16 +531,45 @@ func handlePRMenuClicks(index int, item PRMenuItem) {
 			}
 			prsMutex.RUnlock()
 			if pr.Repo != "" {
-				go reviewPR(pr)
+				goBackground(func() { reviewPR(pr) })
+			}
+		case <-item.preview.ClickedCh:
+			prsMutex.RLock()
+			var pr PRInfo
+			if index < len(prs) {
+				pr = prs[index]
+			}
+			prsMutex.RUnlock()
+			if pr.Repo != "" {
+				owner, _ := parseRepo(pr.Repo)
+				openURLFor(owner, previewURL(pr))
+			}
+		case <-item.approve.ClickedCh:
+			prsMutex.RLock()
+			var pr PRInfo
+			if index < len(prs) {
+				pr = prs[index]
+			}
+			prsMutex.RUnlock()
+			if pr.Repo != "" {
+				goBackground(func() { quickApprove(pr) })
+			}
+		case <-item.nudge.ClickedCh:
+			prsMutex.RLock()
+			var pr PRInfo
+			if index < len(prs) {
+				pr = prs[index]
+			}
+			prsMutex.RUnlock()
+			if pr.Repo != "" {
+				goBackground(func() { handoffFromMenu(pr, actionNudge, "") })
 			}
 		}
 	}
 }
 
 func onExit() {
-	if db != nil {
-		db.Close()
-	}
+	shutdown()
 }
 
 var recheckSchedule []time.Duration
@@ -399,12 +603,13 @@ var activeRechecks sync.Map
 func scheduleRecheck(pr PRInfo) {
 	key := pr.Key()
 
-	if err := dbAddRecheck(pr.Repo, pr.Number); err != nil {
-		log.Printf("Error scheduling recheck for %s: %v", key, err)
+	startedAt := clock.Now()
+	if err := store.AddRecheck(pr.Repo, pr.Number, startedAt); err != nil {
+		recheckLog().Error("Error scheduling recheck", "pr", key, "err", err)
 		return
 	}
 
-	startRecheck(pr.Repo, pr.Number, time.Now())
+	startRecheck(pr.Repo, pr.Number, startedAt)
 }
 
 // startRecheck begins (or resumes) the recheck loop for a single PR.
@@ -416,29 +621,32 @@ func startRecheck(repo string, number int, startedAt time.Time) {
 		return
 	}
 
-	go func() {
+	goBackground(func() {
 		defer activeRechecks.Delete(key)
-		defer dbRemoveRecheck(repo, number)
 
-		runRecheckLoop(repo, number, startedAt)
-	}()
+		// An interrupted schedule keeps its entry so it resumes on next start
+		if runRecheckLoop(appCtx, repo, number, startedAt) {
+			store.RemoveRecheck(repo, number)
+		}
+	})
 }
 
-func runRecheckLoop(repo string, number int, startedAt time.Time) {
+// runRecheckLoop polls a PR on recheckSchedule. Returns false if ctx was
+// cancelled before the schedule finished.
+func runRecheckLoop(ctx context.Context, repo string, number int, startedAt time.Time) bool {
 	owner, repoName := parseRepo(repo)
 	client := getClientForOrg(owner)
 	if client == nil {
-		return
+		return true
 	}
 
-	ctx := context.Background()
 	authorSet := make(map[string]bool)
 	for _, a := range config.Authors {
 		authorSet[a] = true
 	}
 
 	// Compute the absolute time of each check
-	elapsed := time.Since(startedAt)
+	elapsed := clock.Since(startedAt)
 	var cumulative time.Duration
 	didCatchUp := false
 
@@ -451,7 +659,7 @@ func runRecheckLoop(repo string, number int, startedAt time.Time) {
 			if !didCatchUp && cumulative+interval > elapsed {
 				didCatchUp = true
 				if recheckPR(ctx, client, owner, repoName, repo, number, authorSet) {
-					return
+					return true
 				}
 			}
 			continue
@@ -459,48 +667,68 @@ func runRecheckLoop(repo string, number int, startedAt time.Time) {
 
 		// Wait until this check is due
 		waitTime := cumulative - elapsed
-		time.Sleep(waitTime)
-		elapsed = time.Since(startedAt)
+		select {
+		case <-clock.After(waitTime):
+		case <-ctx.Done():
+			return false
+		}
+		elapsed = clock.Since(startedAt)
 
 		if recheckPR(ctx, client, owner, repoName, repo, number, authorSet) {
-			return
+			return true
 		}
 	}
+
+	return ctx.Err() == nil
 }
 
 // recheckPR checks a single PR's status. Returns true if the recheck loop should stop.
 func recheckPR(ctx context.Context, client *github.Client, owner, repoName, repo string, number int, authorSet map[string]bool) bool {
-	if dbIsIgnored(repo, number) || dbIsMuted(repo, number) {
+	if store.IsIgnored(repo, number) || store.IsMuted(repo, number) {
 		return true
 	}
 
 	ghPR, _, err := client.PullRequests.Get(ctx, owner, repoName, number)
 	if err != nil {
-		log.Printf("Recheck: error fetching %s#%d: %v", repo, number, err)
+		recheckLog().Error("Error fetching PR", prAttr(repo, number), "err", err)
 		return false
 	}
 
 	if ghPR.GetState() != "open" || ghPR.GetDraft() || !authorSet[ghPR.GetUser().GetLogin()] {
-		dbRemovePR(repo, number)
+		store.RemovePR(repo, number)
+		reloadPRsFromDB()
+		return true
+	}
+
+	followUp := store.IsFollowUp(repo, number)
+	if followUp && !followUpStillPending(ctx, client, owner, repoName, ghPR) {
+		recheckLog().Info("Clearing follow-up: no review threads awaiting a reply", prAttr(repo, number))
+		followUp = false
+		store.SetFollowUp(repo, number, false)
+	}
+
+	if a, ok := handedOff(repo, ghPR); ok && !followUp {
+		recheckLog().Info("Hiding: handed off", prAttr(repo, number), "action", a.Action, "target", a.Target)
+		store.RemovePR(repo, number)
 		reloadPRsFromDB()
 		return true
 	}
 
 	needsReview, needsReapproval, currentUserReviewed := checkReviewStatus(ctx, client, owner, repoName, ghPR)
-	if !needsReview && !needsReapproval {
-		dbRemovePR(repo, number)
+	if !needsReview && !needsReapproval && !followUp {
+		store.RemovePR(repo, number)
 		reloadPRsFromDB()
 		return true
 	}
 
-	if currentUserReviewed && !isReviewRequestedForUser(ghPR) {
-		log.Printf("Auto-muting %s#%d: current user already reviewed", repo, number)
-		dbMutePR(repo, number)
+	if currentUserReviewed && !isReviewRequestedForUser(ghPR) && !followUp {
+		recheckLog().Info("Auto-muting: current user already reviewed", prAttr(repo, number))
+		store.MutePR(repo, number)
 		reloadPRsFromDB()
 		return true
 	}
 
-	dbSavePR(PRInfo{
+	store.SavePR(PRInfo{
 		Repo:            repo,
 		Number:          ghPR.GetNumber(),
 		Title:           ghPR.GetTitle(),
@@ -508,6 +736,8 @@ func recheckPR(ctx context.Context, client *github.Client, owner, repoName, repo
 		URL:             ghPR.GetHTMLURL(),
 		NeedsReview:     needsReview,
 		NeedsReapproval: needsReapproval,
+		FollowUp:        followUp,
+		Reason:          prReason(ghPR, "", store.PRReason(repo, number)),
 	})
 	reloadPRsFromDB()
 	return false
@@ -515,119 +745,159 @@ func recheckPR(ctx context.Context, client *github.Client, owner, repoName, repo
 
 // resumeRechecks loads pending rechecks from the DB and resumes them.
 func resumeRechecks() {
-	entries, err := dbLoadRechecks()
+	entries, err := store.LoadRechecks()
 	if err != nil {
-		log.Printf("Error loading rechecks: %v", err)
+		recheckLog().Error("Error loading rechecks", "err", err)
 		return
 	}
 
-	now := time.Now()
+	now := clock.Now()
 	for _, e := range entries {
 		if now.Sub(e.StartedAt) > recheckTotalDuration() {
 			// Schedule fully expired — do one final check then clean up
-			go func(e recheckEntry) {
-				defer dbRemoveRecheck(e.Repo, e.Number)
-
+			goBackground(func() {
 				owner, repoName := parseRepo(e.Repo)
-				client := getClientForOrg(owner)
-				if client == nil {
-					return
+				if client := getClientForOrg(owner); client != nil {
+					authorSet := make(map[string]bool)
+					for _, a := range config.Authors {
+						authorSet[a] = true
+					}
+					recheckPR(appCtx, client, owner, repoName, e.Repo, e.Number, authorSet)
 				}
-				authorSet := make(map[string]bool)
-				for _, a := range config.Authors {
-					authorSet[a] = true
+				if appCtx.Err() == nil {
+					store.RemoveRecheck(e.Repo, e.Number)
 				}
-				recheckPR(context.Background(), client, owner, repoName, e.Repo, e.Number, authorSet)
-			}(e)
+			})
 		} else {
 			startRecheck(e.Repo, e.Number, e.StartedAt)
 		}
 	}
 
 	if len(entries) > 0 {
-		log.Printf("Resumed %d pending rechecks", len(entries))
+		recheckLog().Info("Resumed pending rechecks", "count", len(entries))
 	}
 }
 
-func refreshAllRepos() {
-	refreshRepos(config.Repos)
-}
-
-func refreshRepos(repos []string) {
-	ctx := context.Background()
+// defaultRefreshConcurrency is how many repos are refreshed at once unless
+// refresh_concurrency says otherwise.
+const defaultRefreshConcurrency = 4
 
+// runRefresh refreshes repos in parallel, at most refresh_concurrency at a
+// time overall and org_concurrency at a time per org. Each repo's results are
+// saved and shown as soon as it finishes; the menu order doesn't depend on
+// which repo finished first because visiblePRs sorts it. repoDone is called
+// after each repo, successful or not.
+func runRefresh(ctx context.Context, repos []string, repoDone func()) {
 	authorSet := make(map[string]bool)
 	for _, a := range config.Authors {
 		authorSet[a] = true
 	}
 
 	maxAge := time.Duration(config.MaxAgeDays) * 24 * time.Hour
-	cutoff := time.Now().Add(-maxAge)
+	cutoff := clock.Now().Add(-maxAge)
 
-	var newPRsFromRepos []PRInfo
-	repoSet := make(map[string]bool)
-	for _, repo := range repos {
-		repoSet[repo] = true
-		repoPRs := fetchRepoPRs(ctx, repo, authorSet, cutoff)
-		newPRsFromRepos = append(newPRsFromRepos, repoPRs...)
+	limit := defaultRefreshConcurrency
+	if config.RefreshConcurrency > 0 {
+		limit = config.RefreshConcurrency
+	}
+	slots := make(chan struct{}, limit)
+	orgSlots := make(map[string]chan struct{})
+	for org, n := range config.OrgConcurrency {
+		orgSlots[org] = make(chan struct{}, n)
 	}
 
-	// Persist to DB: clear old active PRs for refreshed repos, save new ones
+	var wg sync.WaitGroup
 	for _, repo := range repos {
-		if err := dbRemoveRepoActivePRs(repo); err != nil {
-			log.Printf("Error clearing DB PRs for %s: %v", repo, err)
-		}
-	}
-	for _, pr := range newPRsFromRepos {
-		if err := dbSavePR(pr); err != nil {
-			log.Printf("Error saving PR %s#%d to DB: %v", pr.Repo, pr.Number, err)
-		}
+		owner, _ := parseRepo(repo)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Take the org slot first so repos queued behind a busy org don't
+			// hold global slots other orgs could use
+			release, ok := acquireSlots(ctx, orgSlots[owner], slots)
+			if !ok {
+				// Shutting down; this repo keeps its previous state
+				return
+			}
+			defer release()
+
+			refreshRepo(ctx, repo, authorSet, cutoff)
+			repoDone()
+		}()
 	}
+	wg.Wait()
+}
 
-	// Merge with existing PRs from repos we didn't refresh
-	prsMutex.Lock()
-	var mergedPRs []PRInfo
-	for _, pr := range prs {
-		if !repoSet[pr.Repo] {
-			mergedPRs = append(mergedPRs, pr)
+// acquireSlots takes a slot from each non-nil semaphore in order. It returns
+// false, holding nothing, if ctx is cancelled first.
+func acquireSlots(ctx context.Context, sems ...chan struct{}) (release func(), ok bool) {
+	var held []chan struct{}
+	release = func() {
+		for _, s := range held {
+			<-s
 		}
 	}
-	mergedPRs = append(mergedPRs, newPRsFromRepos...)
 
-	sort.Slice(mergedPRs, func(i, j int) bool {
-		if mergedPRs[i].Repo != mergedPRs[j].Repo {
-			return mergedPRs[i].Repo < mergedPRs[j].Repo
+	for _, s := range sems {
+		if s == nil {
+			continue
 		}
-		return mergedPRs[i].Number < mergedPRs[j].Number
-	})
+		select {
+		case s <- struct{}{}:
+			held = append(held, s)
+		case <-ctx.Done():
+			release()
+			return nil, false
+		}
+	}
+	return release, true
+}
 
-	prs = mergedPRs
-	prsMutex.Unlock()
+// refreshRepo fetches one repo's PRs, replaces its rows in the database and
+// updates the menu.
+func refreshRepo(ctx context.Context, repo string, authorSet map[string]bool, cutoff time.Time) {
+	start := clock.Now()
+	repoPRs, err := fetchRepoPRs(ctx, repo, authorSet, cutoff)
+	if ctx.Err() != nil {
+		return
+	}
+	metrics.repoRefreshed(repo, clock.Since(start))
+	if err != nil {
+		// Keep the previous state for this repo rather than wiping it
+		pollerLog().Error("Error refreshing repo", "repo", repo, "err", err)
+		diag.repoFailed(repo, err)
+		updateMenu()
+		return
+	}
 
-	updateMenu()
+	if err := store.ReplaceRepoPRs(repo, repoPRs); err != nil {
+		dbLog().Error("Error saving PRs", "repo", repo, "err", err)
+		diag.repoFailed(repo, err)
+		return
+	}
+	pollerLog().Debug("Refreshed repo", "repo", repo, "prs", len(repoPRs))
+	diag.repoSucceeded(repo)
+	reloadPRsFromDB()
 }
 
-func fetchRepoPRs(ctx context.Context, repo string, authorSet map[string]bool, cutoff time.Time) []PRInfo {
+func fetchRepoPRs(ctx context.Context, repo string, authorSet map[string]bool, cutoff time.Time) ([]PRInfo, error) {
 	var result []PRInfo
 
 	owner, repoName := parseRepo(repo)
 	if owner == "" {
-		return result
+		return nil, fmt.Errorf("invalid repo %q", repo)
 	}
 
 	client := getClientForOrg(owner)
 	if client == nil {
-		log.Printf("No client available for %s", repo)
-		return result
+		return nil, fmt.Errorf("no client available for %s", repo)
 	}
 
-	pulls, _, err := client.PullRequests.List(ctx, owner, repoName, &github.PullRequestListOptions{
-		State:       "open",
-		ListOptions: github.ListOptions{PerPage: 100},
-	})
+	pulls, err := listOpenPRs(ctx, client, owner, repoName, cutoff)
 	if err != nil {
-		log.Printf("Error fetching PRs for %s: %v", repo, err)
-		return result
+		return nil, fmt.Errorf("fetching PRs: %w", err)
 	}
 
 	for _, pr := range pulls {
@@ -644,24 +914,29 @@ func fetchRepoPRs(ctx context.Context, repo string, authorSet map[string]bool, c
 			continue
 		}
 
-		if dbIsIgnored(repo, pr.GetNumber()) {
+		if store.IsIgnored(repo, pr.GetNumber()) {
 			continue
 		}
 
-		if dbIsMuted(repo, pr.GetNumber()) {
+		if store.IsMuted(repo, pr.GetNumber()) {
 			if isReviewRequestedForUser(pr) {
-				log.Printf("Un-muting %s#%d: review re-requested", repo, pr.GetNumber())
-				dbUnmutePR(repo, pr.GetNumber())
+				pollerLog().Info("Un-muting: review re-requested", prAttr(repo, pr.GetNumber()))
+				store.UnmutePR(repo, pr.GetNumber())
 			} else {
 				continue
 			}
 		}
 
+		followUp := store.IsFollowUp(repo, pr.GetNumber())
+		if _, ok := handedOff(repo, pr); ok && !followUp {
+			continue
+		}
+
 		needsReview, needsReapproval, currentUserReviewed := checkReviewStatus(ctx, client, owner, repoName, pr)
-		if needsReview || needsReapproval {
-			if currentUserReviewed && !isReviewRequestedForUser(pr) {
-				log.Printf("Auto-muting %s#%d: current user already reviewed", repo, pr.GetNumber())
-				dbMutePR(repo, pr.GetNumber())
+		if needsReview || needsReapproval || followUp {
+			if currentUserReviewed && !isReviewRequestedForUser(pr) && !followUp {
+				pollerLog().Info("Auto-muting: current user already reviewed", prAttr(repo, pr.GetNumber()))
+				store.MutePR(repo, pr.GetNumber())
 			} else {
 				result = append(result, PRInfo{
 					Repo:            repo,
@@ -671,18 +946,84 @@ func fetchRepoPRs(ctx context.Context, repo string, authorSet map[string]bool, c
 					URL:             pr.GetHTMLURL(),
 					NeedsReview:     needsReview,
 					NeedsReapproval: needsReapproval,
+					FollowUp:        followUp,
+					Reason:          prReason(pr, "", store.PRReason(repo, pr.GetNumber())),
 				})
 			}
 		}
 	}
 
-	return result
+	return result, nil
+}
+
+// listOpenPRs pages through a repo's open PRs, most recently updated first.
+// A PR can't have been created after it was last updated, so paging stops at
+// the first one last updated before cutoff.
+func listOpenPRs(ctx context.Context, client *github.Client, owner, repo string, cutoff time.Time) ([]*github.PullRequest, error) {
+	opts := &github.PullRequestListOptions{
+		State:       "open",
+		Sort:        "updated",
+		Direction:   "desc",
+		ListOptions: github.ListOptions{PerPage: 100},
+	}
+
+	var all []*github.PullRequest
+	for {
+		page, resp, err := client.PullRequests.List(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, pr := range page {
+			if pr.GetUpdatedAt().Before(cutoff) {
+				return all, nil
+			}
+			all = append(all, pr)
+		}
+		if resp.NextPage == 0 {
+			return all, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func listAllReviews(ctx context.Context, client *github.Client, owner, repo string, number int) ([]*github.PullRequestReview, error) {
+	opts := &github.ListOptions{PerPage: 100}
+	var all []*github.PullRequestReview
+	for {
+		page, resp, err := client.PullRequests.ListReviews(ctx, owner, repo, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+		if resp.NextPage == 0 {
+			return all, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// listAllCommits pages through a PR's commits. GitHub caps this endpoint at
+// 250 commits.
+func listAllCommits(ctx context.Context, client *github.Client, owner, repo string, number int) ([]*github.RepositoryCommit, error) {
+	opts := &github.ListOptions{PerPage: 100}
+	var all []*github.RepositoryCommit
+	for {
+		page, resp, err := client.PullRequests.ListCommits(ctx, owner, repo, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+		if resp.NextPage == 0 {
+			return all, nil
+		}
+		opts.Page = resp.NextPage
+	}
 }
 
 func checkReviewStatus(ctx context.Context, client *github.Client, owner, repo string, pr *github.PullRequest) (needsReview, needsReapproval, currentUserReviewed bool) {
-	reviews, _, err := client.PullRequests.ListReviews(ctx, owner, repo, pr.GetNumber(), &github.ListOptions{PerPage: 100})
+	reviews, err := listAllReviews(ctx, client, owner, repo, pr.GetNumber())
 	if err != nil {
-		log.Printf("Error fetching reviews for %s#%d: %v", repo, pr.GetNumber(), err)
+		pollerLog().Error("Error fetching reviews", prAttr(owner+"/"+repo, pr.GetNumber()), "err", err)
 		return true, false, false
 	}
 
@@ -718,9 +1059,9 @@ func checkReviewStatus(ctx context.Context, client *github.Client, owner, repo s
 		return true, false, currentUserReviewed
 	}
 
-	commits, _, err := client.PullRequests.ListCommits(ctx, owner, repo, pr.GetNumber(), &github.ListOptions{PerPage: 100})
+	commits, err := listAllCommits(ctx, client, owner, repo, pr.GetNumber())
 	if err != nil {
-		log.Printf("Error fetching commits for %s#%d: %v", repo, pr.GetNumber(), err)
+		pollerLog().Error("Error fetching commits", prAttr(owner+"/"+repo, pr.GetNumber()), "err", err)
 		return false, false, currentUserReviewed
 	}
 
@@ -752,37 +1093,54 @@ func parseRepo(repo string) (owner, name string) {
 }
 
 func updateMenu() {
+	// The tray menu only exists once onReady has run (and never in tests)
+	if menuItems == nil {
+		return
+	}
+
 	prsMutex.RLock()
 	defer prsMutex.RUnlock()
 
-	count := len(prs)
-	ignored := dbIgnoredCount()
-	muted := dbMutedCount()
+	count := 0
+	for _, pr := range prs {
+		if !isSilentReason(pr.Reason) {
+			count++
+		}
+	}
+	silent := len(prs) - count
+	ignored := store.IgnoredCount()
+	muted := store.MutedCount()
+
+	problems := diag.problems()
+	systray.SetIcon(getIcon(count > 0, len(problems) > 0))
+	updateStatusMenu(problems)
 
-	systray.SetIcon(getIcon(count > 0))
+	var details []string
+	if silent > 0 {
+		details = append(details, fmt.Sprintf("%d silent", silent))
+	}
+	if ignored > 0 {
+		details = append(details, fmt.Sprintf("%d ignored", ignored))
+	}
+	if muted > 0 {
+		details = append(details, fmt.Sprintf("%d reviewed", muted))
+	}
+	if done, total := refresher.progress(); total > 0 {
+		details = append(details, fmt.Sprintf("refreshing %d/%d", done, total))
+	}
 
 	if count == 0 {
 		systray.SetTitle("")
-		switch {
-		case ignored > 0 && muted > 0:
-			systray.SetTooltip(fmt.Sprintf("No PRs need attention (%d ignored, %d reviewed)", ignored, muted))
-		case ignored > 0:
-			systray.SetTooltip(fmt.Sprintf("No PRs need attention (%d ignored)", ignored))
-		case muted > 0:
-			systray.SetTooltip(fmt.Sprintf("No PRs need attention (%d reviewed)", muted))
-		default:
+		if len(details) > 0 {
+			systray.SetTooltip(fmt.Sprintf("No PRs need attention (%s)", strings.Join(details, ", ")))
+		} else {
 			systray.SetTooltip("No PRs need your attention")
 		}
 	} else {
 		systray.SetTitle(fmt.Sprintf("%d", count))
-		switch {
-		case ignored > 0 && muted > 0:
-			systray.SetTooltip(fmt.Sprintf("%d PRs need attention (%d ignored, %d reviewed)", count, ignored, muted))
-		case ignored > 0:
-			systray.SetTooltip(fmt.Sprintf("%d PRs need attention (%d ignored)", count, ignored))
-		case muted > 0:
-			systray.SetTooltip(fmt.Sprintf("%d PRs need attention (%d reviewed)", count, muted))
-		default:
+		if len(details) > 0 {
+			systray.SetTooltip(fmt.Sprintf("%d PRs need attention (%s)", count, strings.Join(details, ", ")))
+		} else {
 			systray.SetTooltip(fmt.Sprintf("%d PRs need your attention", count))
 		}
 	}
@@ -804,12 +1162,13 @@ func updateMenu() {
 	for i, item := range menuItems {
 		if i < len(prs) {
 			pr := prs[i]
-			status := "needs review"
-			if pr.NeedsReapproval {
-				status = "needs re-approval"
+			status := prStatus(pr)
+			if label := reasonLabel(pr.Reason); label != "" {
+				status += ", " + label
 			}
 			item.parent.SetTitle(fmt.Sprintf("[%s] #%d: %s (%s)", pr.Repo, pr.Number, truncate(pr.Title, 40), status))
 			item.parent.SetTooltip(fmt.Sprintf("%s by @%s", pr.Title, pr.Author))
+			updateHandoffItems(item, pr)
 			item.parent.Show()
 		} else {
 			item.parent.Hide()
@@ -817,6 +1176,17 @@ func updateMenu() {
 	}
 }
 
+func prStatus(pr PRInfo) string {
+	switch {
+	case pr.FollowUp:
+		return "follow-up"
+	case pr.NeedsReapproval:
+		return "needs re-approval"
+	default:
+		return "needs review"
+	}
+}
+
 func truncate(s string, maxLen int) string {
 	runes := []rune(s)
 	if len(runes) <= maxLen {
@@ -825,136 +1195,25 @@ func truncate(s string, maxLen int) string {
 	return string(runes[:maxLen-3]) + "..."
 }
 
-func reviewPR(pr PRInfo) {
-	if runtime.GOOS != "darwin" {
-		log.Printf("Review with Claude is currently only supported on macOS")
-		return
+// updateHandoffItems shows the reassign targets and nudge that apply to pr.
+func updateHandoffItems(item PRMenuItem, pr PRInfo) {
+	targets := reassignTargets(pr.Repo, pr.Author)
+	for _, r := range item.reassign {
+		if slices.Contains(targets, r.target) {
+			r.item.Show()
+		} else {
+			r.item.Hide()
+		}
 	}
-
-	owner, repo := parseRepo(pr.Repo)
-	tempDir, err := os.MkdirTemp("", fmt.Sprintf("pr-review-%s-%s-%d-*", owner, repo, pr.Number))
-	if err != nil {
-		log.Printf("Failed to create temp dir for review: %v", err)
-		return
+	if len(targets) > 0 {
+		item.reassignMenu.Show()
+	} else {
+		item.reassignMenu.Hide()
 	}
 
-	status := "needs review"
 	if pr.NeedsReapproval {
-		status = "needs re-approval"
-	}
-
-	script := fmt.Sprintf(`#!/bin/bash
-set -e
-
-REPO='%s'
-PR_NUM=%d
-AUTHOR='%s'
-STATUS='%s'
-DIR='%s'
-
-echo "==> Cloning $REPO (blobless for speed)..."
-gh repo clone "$REPO" "$DIR/repo" -- --filter=blob:none
-cd "$DIR/repo"
-
-echo "==> Checking out PR #$PR_NUM..."
-gh pr checkout "$PR_NUM"
-
-echo "==> Gathering PR context..."
-PR_JSON=$(gh pr view "$PR_NUM" --json title,body,baseRefName,headRefName,commits)
-PR_TITLE=$(echo "$PR_JSON" | jq -r '.title')
-PR_BODY=$(echo "$PR_JSON" | jq -r '.body')
-BASE_REF=$(echo "$PR_JSON" | jq -r '.baseRefName')
-HEAD_REF=$(echo "$PR_JSON" | jq -r '.headRefName')
-NUM_COMMITS=$(echo "$PR_JSON" | jq '.commits | length')
-
-DIFF_STAT=$(gh pr diff "$PR_NUM" --stat 2>/dev/null || echo "(could not fetch diff stat)")
-COMMIT_LOG=$(git log --oneline "$BASE_REF..$HEAD_REF" 2>/dev/null || echo "(could not fetch commit log)")
-
-echo "==> Building review prompt..."
-cat > "$DIR/prompt.md" <<PROMPT_EOF
-You are reviewing a pull request. Here is the context:
-
-Repository: $REPO
-PR #$PR_NUM: $PR_TITLE
-Author: @$AUTHOR
-Status: $STATUS
-
-PR Description:
-$PR_BODY
-
-This PR contains $NUM_COMMITS commits:
-$COMMIT_LOG
-
-Files changed:
-$DIFF_STAT
-
-You are in a local checkout of this PR. The full source code is available to you.
-
-Please review this PR by:
-1. Reading the changed files to understand the full context of each change
-2. Checking for correctness, bugs, edge cases, and error handling
-3. Evaluating code style and consistency with the surrounding codebase
-4. Looking for security issues (injection, auth, data leaks, etc.)
-5. Noting any performance concerns
-
-Assume CI tests have already passed. Do NOT run tests locally.
-If you have strong reason to believe a change would break tests, you can verify
-CI status with `+"`"+`gh pr checks`+"`"+` — but do not run test suites yourself.
-
-You have access to:
-- The full repository source (use Read/Grep/Glob to explore)
-- `+"`"+`gh`+"`"+` CLI for GitHub context (e.g. `+"`"+`gh pr view`+"`"+`, `+"`"+`gh pr checks`+"`"+`, linked issues)
-
-Provide a structured review with:
-- A summary of what the PR does
-- Issues found (critical, suggestions, nits) with file:line references
-- Questions for the author
-- Overall assessment
-PROMPT_EOF
-
-echo "==> Launching Claude Code for review..."
-echo ""
-exec claude "$(cat "$DIR/prompt.md")"
-`, pr.Repo, pr.Number, pr.Author, status, tempDir)
-
-	scriptPath := filepath.Join(tempDir, "review.sh")
-	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
-		log.Printf("Failed to write review script: %v", err)
-		return
-	}
-
-	openTerminalWithCommand(scriptPath)
-}
-
-func openTerminalWithCommand(scriptPath string) {
-	appleScript := fmt.Sprintf(`tell app "Terminal"
-	activate
-	do script "exec bash '%s'"
-end tell`, scriptPath)
-	cmd := exec.Command("osascript", "-e", appleScript)
-	if err := cmd.Start(); err != nil {
-		log.Printf("Failed to open terminal: %v", err)
-		return
-	}
-	go cmd.Wait()
-}
-
-func openURL(url string) {
-	var cmd *exec.Cmd
-	switch runtime.GOOS {
-	case "darwin":
-		cmd = exec.Command("open", url)
-	case "linux":
-		cmd = exec.Command("xdg-open", url)
-	case "windows":
-		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", url)
-	default:
-		log.Printf("Unsupported platform for opening URLs: %s", runtime.GOOS)
-		return
-	}
-	if err := cmd.Start(); err != nil {
-		log.Printf("Failed to open URL %s: %v", url, err)
-		return
+		item.nudgeMenu.Show()
+	} else {
+		item.nudgeMenu.Hide()
 	}
-	go cmd.Wait()
 }
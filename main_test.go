@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestCheckReviewStatus(t *testing.T) {
+	tests := []struct {
+		name            string
+		reviews         func(gh *fakeGitHub)
+		commits         func(gh *fakeGitHub)
+		needsReview     bool
+		needsReapproval bool
+		reviewed        bool
+	}{
+		{
+			name:        "no reviews",
+			needsReview: true,
+		},
+		{
+			name: "changes requested",
+			reviews: func(gh *fakeGitHub) {
+				gh.addReview(1, "carol", "CHANGES_REQUESTED", testNow.Add(-30*time.Minute))
+			},
+			needsReview: true,
+		},
+		{
+			name: "approved with no later commits",
+			reviews: func(gh *fakeGitHub) {
+				gh.addReview(1, "carol", "APPROVED", testNow.Add(-30*time.Minute))
+			},
+			commits: func(gh *fakeGitHub) {
+				gh.addCommit(1, testNow.Add(-50*time.Minute))
+			},
+		},
+		{
+			name: "commit pushed after approval",
+			reviews: func(gh *fakeGitHub) {
+				gh.addReview(1, "carol", "APPROVED", testNow.Add(-30*time.Minute))
+			},
+			commits: func(gh *fakeGitHub) {
+				gh.addCommit(1, testNow.Add(-10*time.Minute))
+			},
+			needsReapproval: true,
+		},
+		{
+			name: "current user commented",
+			reviews: func(gh *fakeGitHub) {
+				gh.addReview(1, "me", "COMMENTED", testNow.Add(-30*time.Minute))
+			},
+			needsReview: true,
+			reviewed:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gh, _ := setupTest(t)
+			pr := gh.addPR(1, "alice")
+			if tt.reviews != nil {
+				tt.reviews(gh)
+			}
+			if tt.commits != nil {
+				tt.commits(gh)
+			}
+
+			needsReview, needsReapproval, reviewed := checkReviewStatus(context.Background(), gh.client(), "acme", "api", pr)
+			if needsReview != tt.needsReview || needsReapproval != tt.needsReapproval || reviewed != tt.reviewed {
+				t.Errorf("checkReviewStatus = (%v, %v, %v), want (%v, %v, %v)",
+					needsReview, needsReapproval, reviewed, tt.needsReview, tt.needsReapproval, tt.reviewed)
+			}
+		})
+	}
+}
+
+func TestRefreshListsPRsNeedingReview(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.addPR(1, "alice", requested("me"))
+	gh.addPR(2, "mallory") // not a configured author
+	gh.addPR(3, "bob", func(pr *github.PullRequest) { pr.Draft = github.Bool(true) })
+	gh.addPR(4, "bob", func(pr *github.PullRequest) {
+		pr.CreatedAt = &github.Timestamp{Time: testNow.Add(-4 * 24 * time.Hour)}
+	})
+
+	refreshAllRepos(t.Context())
+
+	got := prNumbers(t)
+	if len(got) != 1 || got[0] != 1 {
+		t.Fatalf("listed PRs = %v, want [1]", got)
+	}
+	if prs[0].Reason != reasonDirect {
+		t.Errorf("reason = %q, want %q", prs[0].Reason, reasonDirect)
+	}
+}
+
+func TestRefreshAutoMutesReviewedPR(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.addPR(1, "alice")
+	gh.addReview(1, "me", "COMMENTED", testNow.Add(-30*time.Minute))
+
+	refreshAllRepos(t.Context())
+
+	if got := prNumbers(t); len(got) != 0 {
+		t.Fatalf("listed PRs = %v, want none", got)
+	}
+	if !store.IsMuted("acme/api", 1) {
+		t.Error("PR reviewed by the current user was not muted")
+	}
+}
+
+func TestRefreshUnmutesWhenReviewReRequested(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.addPR(1, "alice")
+	gh.addReview(1, "me", "COMMENTED", testNow.Add(-30*time.Minute))
+
+	refreshAllRepos(t.Context())
+	if !store.IsMuted("acme/api", 1) {
+		t.Fatal("PR was not muted after the first refresh")
+	}
+
+	gh.update(1, requested("me"))
+	refreshAllRepos(t.Context())
+
+	if store.IsMuted("acme/api", 1) {
+		t.Error("PR is still muted after review was re-requested")
+	}
+	if got := prNumbers(t); len(got) != 1 || got[0] != 1 {
+		t.Fatalf("listed PRs = %v, want [1]", got)
+	}
+}
+
+func TestRefreshErrorKeepsExistingPRs(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.addPR(1, "alice")
+
+	refreshAllRepos(t.Context())
+	if got := prNumbers(t); len(got) != 1 {
+		t.Fatalf("listed PRs = %v, want [1]", got)
+	}
+
+	gh.mu.Lock()
+	gh.failRepos["acme/api"] = true
+	gh.mu.Unlock()
+	refreshAllRepos(t.Context())
+
+	if got := prNumbers(t); len(got) != 1 || got[0] != 1 {
+		t.Errorf("listed PRs after failed refresh = %v, want [1]", got)
+	}
+}
+
+func TestRecheckFollowsSchedule(t *testing.T) {
+	gh, clk := setupTest(t)
+	gh.addPR(1, "alice")
+
+	refreshAllRepos(t.Context())
+	scheduleRecheck(PRInfo{Repo: "acme/api", Number: 1})
+
+	// The first check is due a minute after scheduling
+	waitFor(t, "first recheck timer", func() bool { return clk.Waiters() == 1 })
+	if n := gh.requestCount("GET", "/repos/acme/api/pulls/1"); n != 0 {
+		t.Fatalf("PR fetched %d times before the first check was due", n)
+	}
+
+	clk.Advance(time.Minute)
+	waitFor(t, "first recheck", func() bool { return gh.requestCount("GET", "/repos/acme/api/pulls/1") == 1 })
+
+	// Approve it; the next check drops the PR and ends the schedule
+	waitFor(t, "second recheck timer", func() bool { return clk.Waiters() == 1 })
+	gh.addReview(1, "carol", "APPROVED", clk.Now())
+	clk.Advance(time.Minute)
+
+	waitFor(t, "recheck to finish", func() bool { return countActiveRechecks() == 0 })
+	if got := prNumbers(t); len(got) != 0 {
+		t.Errorf("listed PRs = %v, want none", got)
+	}
+	if entries, _ := store.LoadRechecks(); len(entries) != 0 {
+		t.Errorf("recheck entries = %v, want none", entries)
+	}
+}
+
+func TestRecheckResumesAfterRestart(t *testing.T) {
+	gh, clk := setupTest(t)
+	gh.addPR(1, "alice")
+	refreshAllRepos(t.Context())
+
+	// A recheck started 90s ago has missed its first check at 60s
+	if err := store.AddRecheck("acme/api", 1, clk.Now().Add(-90*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	gh.addReview(1, "carol", "APPROVED", clk.Now().Add(-time.Minute))
+
+	resumeRechecks()
+
+	waitFor(t, "catch-up recheck", func() bool { return countActiveRechecks() == 0 })
+	if n := gh.requestCount("GET", "/repos/acme/api/pulls/1"); n != 1 {
+		t.Errorf("PR fetched %d times, want a single catch-up check", n)
+	}
+	if got := prNumbers(t); len(got) != 0 {
+		t.Errorf("listed PRs = %v, want none", got)
+	}
+	if entries, _ := store.LoadRechecks(); len(entries) != 0 {
+		t.Errorf("recheck entries = %v, want none", entries)
+	}
+}
+
+// prNumbers returns the numbers of the PRs currently shown in the menu.
+func prNumbers(t *testing.T) []int {
+	t.Helper()
+	prsMutex.RLock()
+	defer prsMutex.RUnlock()
+
+	var numbers []int
+	for _, pr := range prs {
+		numbers = append(numbers, pr.Number)
+	}
+	return numbers
+}
+
+func TestShutdownKeepsInterruptedRecheck(t *testing.T) {
+	gh, clk := setupTest(t)
+	gh.addPR(1, "alice")
+	refreshAllRepos(t.Context())
+
+	scheduleRecheck(PRInfo{Repo: "acme/api", Number: 1})
+	waitFor(t, "first recheck timer", func() bool { return clk.Waiters() == 1 })
+
+	cancelApp()
+	background.Wait()
+
+	if n := countActiveRechecks(); n != 0 {
+		t.Errorf("%d rechecks still running after cancellation", n)
+	}
+	// The schedule was cut short, so it must resume on next start
+	if entries, _ := store.LoadRechecks(); len(entries) != 1 {
+		t.Errorf("recheck entries = %v, want the interrupted one", entries)
+	}
+}
+
+func TestRefreshRespectsConcurrencyLimits(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.listDelay = 20 * time.Millisecond
+	config.Repos = nil
+	for i := 1; i <= 4; i++ {
+		for _, org := range []string{"acme", "globex"} {
+			repo := fmt.Sprintf("%s/repo%d", org, i)
+			config.Repos = append(config.Repos, repo)
+			gh.addRepoPR(repo, i, "alice")
+		}
+	}
+	config.RefreshConcurrency = 3
+	config.OrgConcurrency = map[string]int{"acme": 1}
+
+	refreshAllRepos(t.Context())
+
+	gh.mu.Lock()
+	acme, globex := gh.maxListsInFlight["acme"], gh.maxListsInFlight["globex"]
+	gh.mu.Unlock()
+	if acme != 1 {
+		t.Errorf("acme had %d repos refreshing at once, want 1", acme)
+	}
+	if globex < 2 || acme+globex > 3 {
+		t.Errorf("globex had %d repos refreshing at once, want 2 (3 overall, 1 taken by acme)", globex)
+	}
+	if got := prNumbers(t); len(got) != 8 {
+		t.Errorf("listed %d PRs, want 8", len(got))
+	}
+}
+
+func TestRefreshListsPRsInStableOrder(t *testing.T) {
+	gh, _ := setupTest(t)
+	config.Repos = []string{"acme/web", "acme/api"}
+	gh.addRepoPR("acme/web", 2, "alice")
+	gh.addRepoPR("acme/api", 9, "alice")
+	gh.addRepoPR("acme/api", 3, "bob")
+
+	refreshAllRepos(t.Context())
+
+	prsMutex.RLock()
+	var got []string
+	for _, pr := range prs {
+		got = append(got, pr.Key())
+	}
+	prsMutex.RUnlock()
+
+	want := []string{"acme/api#3", "acme/api#9", "acme/web#2"}
+	if !slices.Equal(got, want) {
+		t.Errorf("PR order = %v, want %v", got, want)
+	}
+}
+
+func TestRefreshCoalescesConcurrentRequests(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.addPR(1, "alice")
+	gh.listDelay = 50 * time.Millisecond
+
+	first := make(chan struct{})
+	go func() {
+		refreshAllRepos(t.Context())
+		close(first)
+	}()
+	waitFor(t, "first refresh to start", func() bool {
+		done, total := refresher.progress()
+		return total == 1 && done == 0
+	})
+
+	// Everything requested while the first run is in flight shares one follow-up run
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			refreshAllRepos(t.Context())
+		}()
+	}
+	wg.Wait()
+	<-first
+
+	if n := gh.requestCount("GET", "/repos/acme/api/pulls"); n != 2 {
+		t.Errorf("repo listed %d times, want 2", n)
+	}
+	if _, total := refresher.progress(); total != 0 {
+		t.Errorf("progress total = %d after refresh finished, want 0", total)
+	}
+}
+
+func TestRefreshReposOnlyTouchesRequestedRepos(t *testing.T) {
+	gh, _ := setupTest(t)
+	config.Repos = []string{"acme/api", "acme/web"}
+	gh.addRepoPR("acme/api", 1, "alice")
+	gh.addRepoPR("acme/web", 2, "alice")
+
+	refreshRepos(t.Context(), []string{"acme/web"})
+
+	if n := gh.requestCount("GET", "/repos/acme/api/pulls"); n != 0 {
+		t.Errorf("acme/api listed %d times, want 0", n)
+	}
+	if got := prNumbers(t); !slices.Equal(got, []int{2}) {
+		t.Errorf("listed PRs = %v, want [2]", got)
+	}
+}
+
+func TestRefreshPagesThroughPRs(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.maxPerPage = 2
+	for n := 1; n <= 3; n++ {
+		gh.addPR(n, "alice")
+	}
+	// Updated before the cutoff, so paging stops once it reaches them
+	for n := 4; n <= 7; n++ {
+		gh.addPR(n, "alice", func(pr *github.PullRequest) {
+			old := &github.Timestamp{Time: testNow.Add(-5 * 24 * time.Hour)}
+			pr.CreatedAt, pr.UpdatedAt = old, old
+		})
+	}
+
+	refreshAllRepos(t.Context())
+
+	if got := prNumbers(t); !slices.Equal(got, []int{1, 2, 3}) {
+		t.Errorf("listed PRs = %v, want [1 2 3]", got)
+	}
+	if n := gh.requestCount("GET", "/repos/acme/api/pulls"); n != 2 {
+		t.Errorf("requested %d pages of PRs, want 2", n)
+	}
+}
+
+func TestCheckReviewStatusPagesThroughReviewsAndCommits(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.maxPerPage = 1
+	pr := gh.addPR(1, "alice")
+	gh.addReview(1, "carol", "CHANGES_REQUESTED", testNow.Add(-50*time.Minute))
+	gh.addReview(1, "carol", "APPROVED", testNow.Add(-30*time.Minute))
+	gh.addCommit(1, testNow.Add(-55*time.Minute))
+	gh.addCommit(1, testNow.Add(-10*time.Minute))
+
+	needsReview, needsReapproval, _ := checkReviewStatus(t.Context(), gh.client(), "acme", "api", pr)
+	if needsReview || !needsReapproval {
+		t.Errorf("checkReviewStatus = (%v, %v), want the approval and the later commit from page 2 to count", needsReview, needsReapproval)
+	}
+}
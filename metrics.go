@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The metrics endpoint exposes poller behaviour in the OpenMetrics text
+// format for a shared instance to be scraped by Prometheus. Counters are
+// collected whether or not the endpoint is enabled; they're cheap and reset
+// on restart.
+
+const metricsPath = "/metrics"
+
+type MetricsConfig struct {
+	Listen string `yaml:"listen"`
+}
+
+func metricsEnabled() bool {
+	return config.Metrics.Listen != ""
+}
+
+type durationSummary struct {
+	count int64
+	sum   time.Duration
+}
+
+type requestKey struct {
+	token, code string
+}
+
+type pollerMetrics struct {
+	mu                sync.Mutex
+	refreshes         map[string]*durationSummary // by repo
+	requests          map[requestKey]int64
+	rateLimit         map[string]int64 // remaining, by token
+	notificationPolls map[string]int64 // by result
+	dbWriteErrors     int64
+}
+
+var metrics = newPollerMetrics()
+
+func newPollerMetrics() *pollerMetrics {
+	return &pollerMetrics{
+		refreshes:         make(map[string]*durationSummary),
+		requests:          make(map[requestKey]int64),
+		rateLimit:         make(map[string]int64),
+		notificationPolls: make(map[string]int64),
+	}
+}
+
+func (m *pollerMetrics) repoRefreshed(repo string, took time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.refreshes[repo]
+	if s == nil {
+		s = &durationSummary{}
+		m.refreshes[repo] = s
+	}
+	s.count++
+	s.sum += took
+}
+
+// observeRequest counts an API call made with the named token. resp is nil
+// when the request failed before GitHub answered.
+func (m *pollerMetrics) observeRequest(token string, resp *http.Response) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if resp == nil {
+		m.requests[requestKey{token, "error"}]++
+		return
+	}
+	m.requests[requestKey{token, strconv.Itoa(resp.StatusCode)}]++
+	if remaining, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Remaining"), 10, 64); err == nil {
+		m.rateLimit[token] = remaining
+	}
+}
+
+// notificationPoll records the outcome of a notification poll: modified,
+// not_modified or error.
+func (m *pollerMetrics) notificationPoll(result string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notificationPolls[result]++
+}
+
+func (m *pollerMetrics) dbWriteFailed() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dbWriteErrors++
+}
+
+// write renders every metric. PR counts and active rechecks are read at
+// scrape time rather than tracked.
+func (m *pollerMetrics) write(w *metricsWriter) {
+	counts := prStatusCounts()
+	w.family("pr_monitor_prs", "gauge", "PRs in the review queue by status.")
+	for _, status := range []string{"needs_review", "needs_reapproval", "follow_up", "ignored", "reviewed"} {
+		w.sample("pr_monitor_prs", float64(counts[status]), "status", status)
+	}
+
+	var rechecks int
+	activeRechecks.Range(func(_, _ any) bool {
+		rechecks++
+		return true
+	})
+	w.family("pr_monitor_active_rechecks", "gauge", "Recheck goroutines currently running.")
+	w.sample("pr_monitor_active_rechecks", float64(rechecks))
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	w.family("pr_monitor_repo_refresh_duration_seconds", "summary", "Time taken to refresh a repo.")
+	for _, repo := range sortedKeys(m.refreshes) {
+		s := m.refreshes[repo]
+		w.sample("pr_monitor_repo_refresh_duration_seconds_count", float64(s.count), "repo", repo)
+		w.sample("pr_monitor_repo_refresh_duration_seconds_sum", s.sum.Seconds(), "repo", repo)
+	}
+
+	w.family("pr_monitor_github_requests", "counter", "GitHub API requests by token and response status.")
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b requestKey) int {
+		return strings.Compare(a.token+" "+a.code, b.token+" "+b.code)
+	})
+	for _, k := range keys {
+		w.sample("pr_monitor_github_requests_total", float64(m.requests[k]), "token", k.token, "code", k.code)
+	}
+
+	w.family("pr_monitor_github_rate_limit_remaining", "gauge", "Requests left in the current rate limit window, by token.")
+	for _, token := range sortedKeys(m.rateLimit) {
+		w.sample("pr_monitor_github_rate_limit_remaining", float64(m.rateLimit[token]), "token", token)
+	}
+
+	w.family("pr_monitor_notification_polls", "counter", "Notification polls by result.")
+	for _, result := range []string{"modified", "not_modified", "error"} {
+		w.sample("pr_monitor_notification_polls_total", float64(m.notificationPolls[result]), "result", result)
+	}
+
+	w.family("pr_monitor_db_write_errors", "counter", "Failed database writes.")
+	w.sample("pr_monitor_db_write_errors_total", float64(m.dbWriteErrors))
+}
+
+func prStatusCounts() map[string]int {
+	counts := make(map[string]int)
+	prsMutex.RLock()
+	for _, pr := range prs {
+		switch {
+		case pr.FollowUp:
+			counts["follow_up"]++
+		case pr.NeedsReapproval:
+			counts["needs_reapproval"]++
+		case pr.NeedsReview:
+			counts["needs_review"]++
+		}
+	}
+	prsMutex.RUnlock()
+	counts["ignored"] = store.IgnoredCount()
+	counts["reviewed"] = store.MutedCount()
+	return counts
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	var mw metricsWriter
+	metrics.write(&mw)
+	mw.b.WriteString("# EOF\n")
+
+	w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	w.Write([]byte(mw.b.String()))
+}
+
+// metricsWriter renders the OpenMetrics text format.
+type metricsWriter struct {
+	b strings.Builder
+}
+
+func (w *metricsWriter) family(name, typ, help string) {
+	fmt.Fprintf(&w.b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// sample writes one value; labels are name/value pairs.
+func (w *metricsWriter) sample(name string, value float64, labels ...string) {
+	w.b.WriteString(name)
+	if len(labels) > 0 {
+		w.b.WriteByte('{')
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				w.b.WriteByte(',')
+			}
+			fmt.Fprintf(&w.b, "%s=\"%s\"", labels[i], escapeLabel(labels[i+1]))
+		}
+		w.b.WriteByte('}')
+	}
+	fmt.Fprintf(&w.b, " %s\n", strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+// writeErrorCounter wraps a PRStore and counts failed writes for the
+// pr_monitor_db_write_errors metric.
+type writeErrorCounter struct {
+	PRStore
+}
+
+func countWriteErrors(err error) error {
+	if err != nil {
+		metrics.dbWriteFailed()
+	}
+	return err
+}
+
+func (s writeErrorCounter) SavePR(pr PRInfo) error {
+	return countWriteErrors(s.PRStore.SavePR(pr))
+}
+
+func (s writeErrorCounter) RemovePR(repo string, number int) error {
+	return countWriteErrors(s.PRStore.RemovePR(repo, number))
+}
+
+func (s writeErrorCounter) ReplaceRepoPRs(repo string, repoPRs []PRInfo) error {
+	return countWriteErrors(s.PRStore.ReplaceRepoPRs(repo, repoPRs))
+}
+
+func (s writeErrorCounter) IgnorePR(repo string, number int) error {
+	return countWriteErrors(s.PRStore.IgnorePR(repo, number))
+}
+
+func (s writeErrorCounter) ClearIgnored() error {
+	return countWriteErrors(s.PRStore.ClearIgnored())
+}
+
+func (s writeErrorCounter) MutePR(repo string, number int) error {
+	return countWriteErrors(s.PRStore.MutePR(repo, number))
+}
+
+func (s writeErrorCounter) UnmutePR(repo string, number int) error {
+	return countWriteErrors(s.PRStore.UnmutePR(repo, number))
+}
+
+func (s writeErrorCounter) ClearMuted() error {
+	return countWriteErrors(s.PRStore.ClearMuted())
+}
+
+func (s writeErrorCounter) SetFollowUp(repo string, number int, followUp bool) error {
+	return countWriteErrors(s.PRStore.SetFollowUp(repo, number, followUp))
+}
+
+func (s writeErrorCounter) UpdateReviewThreads(repo string, number int, author string, threads []reviewThread) (bool, error) {
+	changed, err := s.PRStore.UpdateReviewThreads(repo, number, author, threads)
+	return changed, countWriteErrors(err)
+}
+
+func (s writeErrorCounter) SetState(key, value string) error {
+	return countWriteErrors(s.PRStore.SetState(key, value))
+}
+
+func (s writeErrorCounter) RecordAction(a prAction) error {
+	return countWriteErrors(s.PRStore.RecordAction(a))
+}
+
+func (s writeErrorCounter) MarkThreadProcessed(id string, updatedAt time.Time) error {
+	return countWriteErrors(s.PRStore.MarkThreadProcessed(id, updatedAt))
+}
+
+func (s writeErrorCounter) PruneProcessedThreads(before time.Time) error {
+	return countWriteErrors(s.PRStore.PruneProcessedThreads(before))
+}
+
+func (s writeErrorCounter) SaveCachedResponse(key string, r cachedResponse, now time.Time) error {
+	return countWriteErrors(s.PRStore.SaveCachedResponse(key, r, now))
+}
+
+func (s writeErrorCounter) TouchCachedResponse(key string, now time.Time) error {
+	return countWriteErrors(s.PRStore.TouchCachedResponse(key, now))
+}
+
+func (s writeErrorCounter) PruneHTTPCache(before time.Time) error {
+	return countWriteErrors(s.PRStore.PruneHTTPCache(before))
+}
+
+func (s writeErrorCounter) AddRecheck(repo string, number int, startedAt time.Time) error {
+	return countWriteErrors(s.PRStore.AddRecheck(repo, number, startedAt))
+}
+
+func (s writeErrorCounter) RemoveRecheck(repo string, number int) error {
+	return countWriteErrors(s.PRStore.RemoveRecheck(repo, number))
+}
+
+func (s writeErrorCounter) ApplyTriageEvent(e triageEvent) (bool, error) {
+	applied, err := s.PRStore.ApplyTriageEvent(e)
+	return applied, countWriteErrors(err)
+}
+
+func (s writeErrorCounter) SaveTriageState(e triageEvent) error {
+	return countWriteErrors(s.PRStore.SaveTriageState(e))
+}
+
+func (s writeErrorCounter) Import(doc exportDoc, replace bool) error {
+	return countWriteErrors(s.PRStore.Import(doc, replace))
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func scrapeMetrics(t *testing.T) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handleMetrics(rec, httptest.NewRequest("GET", metricsPath, nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/openmetrics-text") {
+		t.Errorf("Content-Type = %q, want OpenMetrics", ct)
+	}
+	body := rec.Body.String()
+	if !strings.HasSuffix(body, "# EOF\n") {
+		t.Errorf("exposition doesn't end with # EOF:\n%s", body)
+	}
+	return body
+}
+
+func assertMetric(t *testing.T, body, sample string) {
+	t.Helper()
+	for _, line := range strings.Split(body, "\n") {
+		if line == sample {
+			return
+		}
+	}
+	t.Errorf("missing %q in:\n%s", sample, body)
+}
+
+func TestMetricsReportPollerActivity(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.addPR(1, "alice")
+	gh.addPR(2, "bob")
+	gh.headers = http.Header{"X-Ratelimit-Remaining": {"4321"}}
+	gh.notifications = []*github.Notification{
+		prNotification("100", "acme/api", 1, "review_requested", testNow),
+	}
+
+	refreshAllRepos(t.Context())
+	if _, err := pollNotifications(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.IgnorePR("acme/api", 2); err != nil {
+		t.Fatal(err)
+	}
+	reloadPRsFromDB()
+
+	gh.status = http.StatusBadGateway
+	if _, err := pollNotifications(t.Context()); err == nil {
+		t.Fatal("expected the poll to fail")
+	}
+
+	body := scrapeMetrics(t)
+	assertMetric(t, body, `pr_monitor_prs{status="needs_review"} 1`)
+	assertMetric(t, body, `pr_monitor_prs{status="ignored"} 1`)
+	assertMetric(t, body, `pr_monitor_repo_refresh_duration_seconds_count{repo="acme/api"} 1`)
+	assertMetric(t, body, `pr_monitor_github_rate_limit_remaining{token="default"} 4321`)
+	assertMetric(t, body, `pr_monitor_github_requests_total{token="default",code="502"} 1`)
+	assertMetric(t, body, `pr_monitor_notification_polls_total{result="modified"} 1`)
+	assertMetric(t, body, `pr_monitor_notification_polls_total{result="error"} 1`)
+	assertMetric(t, body, `pr_monitor_active_rechecks 0`)
+	assertMetric(t, body, `pr_monitor_db_write_errors_total 0`)
+}
+
+type failingStore struct {
+	PRStore
+}
+
+func (failingStore) SetState(key, value string) error {
+	return errors.New("disk I/O error")
+}
+
+func TestMetricsCountDBWriteErrors(t *testing.T) {
+	setupTest(t)
+	store = writeErrorCounter{failingStore{store}}
+
+	store.SetState("k", "v")
+	store.SetState("k", "v")
+
+	assertMetric(t, scrapeMetrics(t), `pr_monitor_db_write_errors_total 2`)
+}
+
+func TestMetricsEscapeLabels(t *testing.T) {
+	var w metricsWriter
+	w.sample("m", 1.5, "l", "a\"b\\c\nd")
+	if got, want := w.b.String(), `m{l="a\"b\\c\nd"} 1.5`+"\n"; got != want {
+		t.Errorf("sample = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+)
+
+// migration is a single numbered schema change. Migrations are applied in
+// order, each in its own transaction, and recorded in schema_migrations.
+// Never edit or reorder a migration once it has shipped — append a new one.
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+var migrations = []migration{
+	{1, "initial schema", migrateInitialSchema},
+	{2, "add prs.muted", migrateAddMuted},
+	{3, "add triage_state", migrateAddTriageState},
+	{4, "add follow-up tracking", migrateAddFollowUp},
+	{5, "add prs.reason", migrateAddReason},
+	{6, "add notification_threads", migrateAddNotificationThreads},
+	{7, "add http_cache", migrateAddHTTPCache},
+	{8, "add pr_actions", migrateAddPRActions},
+}
+
+func migrateInitialSchema(tx *sql.Tx) error {
+	// IF NOT EXISTS so databases created before versioned migrations are adopted as-is
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS prs (
+			repo TEXT NOT NULL,
+			number INTEGER NOT NULL,
+			title TEXT NOT NULL,
+			author TEXT NOT NULL,
+			url TEXT NOT NULL,
+			needs_review INTEGER NOT NULL DEFAULT 0,
+			needs_reapproval INTEGER NOT NULL DEFAULT 0,
+			ignored INTEGER NOT NULL DEFAULT 0,
+			last_checked TEXT NOT NULL,
+			PRIMARY KEY (repo, number)
+		);
+
+		CREATE TABLE IF NOT EXISTS state (
+			key TEXT PRIMARY KEY,
+			value TEXT NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS rechecks (
+			repo TEXT NOT NULL,
+			number INTEGER NOT NULL,
+			started_at TEXT NOT NULL,
+			PRIMARY KEY (repo, number)
+		);
+	`)
+	return err
+}
+
+func migrateAddMuted(tx *sql.Tx) error {
+	return addColumnIfMissing(tx, "prs", "muted", "INTEGER NOT NULL DEFAULT 0")
+}
+
+func migrateAddTriageState(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE triage_state (
+			repo TEXT NOT NULL,
+			number INTEGER NOT NULL,
+			field TEXT NOT NULL,
+			value INTEGER NOT NULL,
+			updated_at TEXT NOT NULL,
+			device TEXT NOT NULL,
+			PRIMARY KEY (repo, number, field)
+		)
+	`)
+	return err
+}
+
+func migrateAddFollowUp(tx *sql.Tx) error {
+	if err := addColumnIfMissing(tx, "prs", "follow_up", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`
+		CREATE TABLE review_threads (
+			repo TEXT NOT NULL,
+			number INTEGER NOT NULL,
+			thread_id TEXT NOT NULL,
+			resolved INTEGER NOT NULL DEFAULT 0,
+			last_author TEXT NOT NULL,
+			last_comment_at TEXT NOT NULL,
+			PRIMARY KEY (repo, number, thread_id)
+		)
+	`)
+	return err
+}
+
+func migrateAddReason(tx *sql.Tx) error {
+	return addColumnIfMissing(tx, "prs", "reason", "TEXT NOT NULL DEFAULT ''")
+}
+
+func migrateAddNotificationThreads(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE notification_threads (
+			id TEXT PRIMARY KEY,
+			updated_at TEXT NOT NULL,
+			processed_at TEXT NOT NULL
+		)
+	`)
+	return err
+}
+
+func migrateAddHTTPCache(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE http_cache (
+			key TEXT PRIMARY KEY,
+			etag TEXT NOT NULL,
+			header TEXT NOT NULL,
+			body BLOB NOT NULL,
+			used_at TEXT NOT NULL
+		)
+	`)
+	return err
+}
+
+func migrateAddPRActions(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE pr_actions (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			repo TEXT NOT NULL,
+			number INTEGER NOT NULL,
+			action TEXT NOT NULL,
+			target TEXT NOT NULL,
+			head_sha TEXT NOT NULL,
+			created_at TEXT NOT NULL
+		);
+		CREATE INDEX pr_actions_pr ON pr_actions (repo, number);
+	`)
+	return err
+}
+
+func (s *sqliteStore) migrate() error {
+	if _, err := s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TEXT NOT NULL
+		)
+	`); err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	current, err := s.schemaVersion()
+	if err != nil {
+		return err
+	}
+
+	latest := migrations[len(migrations)-1].version
+	if current > latest {
+		return fmt.Errorf("database schema version %d is newer than this binary supports (%d); upgrade pr-monitor or restore a backup", current, latest)
+	}
+	if current == latest {
+		return nil
+	}
+
+	hasData, err := s.hasExistingTables()
+	if err != nil {
+		return err
+	}
+	if hasData {
+		backupPath, err := s.backup(current)
+		if err != nil {
+			return fmt.Errorf("backing up database before migration: %w", err)
+		}
+		dbLog().Info("Backed up database before migrating", "backup", backupPath, "from_version", current)
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := s.applyMigration(m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+		dbLog().Info("Applied migration", "version", m.version, "name", m.name)
+	}
+
+	return nil
+}
+
+func (s *sqliteStore) applyMigration(m migration) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.up(tx); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)",
+		m.version, m.name, time.Now().Format(time.RFC3339),
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqliteStore) schemaVersion() (int, error) {
+	var version sql.NullInt64
+	if err := s.db.QueryRow("SELECT MAX(version) FROM schema_migrations").Scan(&version); err != nil {
+		return 0, fmt.Errorf("reading schema version: %w", err)
+	}
+	return int(version.Int64), nil
+}
+
+// hasExistingTables reports whether the database holds anything worth backing
+// up, i.e. it isn't a freshly created file.
+func (s *sqliteStore) hasExistingTables() (bool, error) {
+	var count int
+	err := s.db.QueryRow(`
+		SELECT COUNT(*) FROM sqlite_master
+		WHERE type = 'table' AND name NOT IN ('schema_migrations') AND name NOT LIKE 'sqlite_%'
+	`).Scan(&count)
+	return count > 0, err
+}
+
+// backup writes a consistent snapshot of the database next to it, named after
+// the schema version it was taken at.
+func (s *sqliteStore) backup(version int) (string, error) {
+	backupPath := fmt.Sprintf("%s.v%d-%s.bak", s.path, version, time.Now().Format("20060102-150405"))
+	if _, err := os.Stat(backupPath); err == nil {
+		return "", fmt.Errorf("backup file %s already exists", backupPath)
+	}
+	if _, err := s.db.Exec("VACUUM INTO ?", backupPath); err != nil {
+		return "", err
+	}
+	return backupPath, nil
+}
+
+func addColumnIfMissing(tx *sql.Tx, table, column, definition string) error {
+	exists, err := columnExists(tx, table, column)
+	if err != nil || exists {
+		return err
+	}
+	_, err = tx.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+func columnExists(tx *sql.Tx, table, column string) (bool, error) {
+	rows, err := tx.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid          int
+			name, ctype  string
+			notNull, pk  int
+			defaultValue sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &ctype, &notNull, &defaultValue, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
@@ -3,10 +3,10 @@ package main
 import (
 	"context"
 	"fmt"
-	"log"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/google/go-github/v57/github"
@@ -15,33 +15,58 @@ import (
 const (
 	defaultNotificationInterval = 60 * time.Second
 	defaultFullRefreshInterval  = 30 * time.Minute
+
+	// processedThreadRetention is how long processed thread IDs are remembered
+	processedThreadRetention = 30 * 24 * time.Hour
+)
+
+// Notification modes. mark_read marks each processed PR thread as read, which
+// keeps the unread list short. preserve leaves read state alone and instead
+// remembers which thread updates have been processed, for inboxes shared with
+// other tools or people.
+const (
+	notificationModeMarkRead = "mark_read"
+	notificationModePreserve = "preserve"
 )
 
+func preserveNotifications() bool {
+	return config.NotificationMode == notificationModePreserve
+}
+
 // notificationLoop polls GitHub's notifications API as the primary update mechanism.
 // Uses If-Modified-Since to avoid consuming rate limit when nothing changed.
-func notificationLoop() {
+func notificationLoop(ctx context.Context) {
 	// Run initial cleanup if needed
-	if err := initialNotificationCleanup(); err != nil {
-		log.Printf("Warning: initial notification cleanup failed: %v", err)
+	if err := initialNotificationCleanup(ctx); err != nil {
+		pollerLog().Warn("Initial notification cleanup failed", "err", err)
 	}
 
 	// Do an immediate full refresh to populate from all repos
-	refreshAllRepos()
+	refreshAllRepos(ctx)
 
 	pollInterval := defaultNotificationInterval
-	if stored := dbGetState("notifications_poll_interval"); stored != "" {
+	if stored := store.GetState("notifications_poll_interval"); stored != "" {
 		if secs, err := strconv.Atoi(stored); err == nil && secs > 0 {
 			pollInterval = time.Duration(secs) * time.Second
 		}
 	}
 
-	ticker := time.NewTicker(pollInterval)
+	ticker := clock.NewTicker(pollInterval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		newInterval, err := pollNotifications()
+	for {
+		select {
+		case <-ticker.C():
+		case <-ctx.Done():
+			return
+		}
+
+		newInterval, err := pollNotifications(ctx)
 		if err != nil {
-			log.Printf("Notification poll error: %v", err)
+			if ctx.Err() != nil {
+				return
+			}
+			pollerLog().Error("Notification poll error", "err", err)
 			continue
 		}
 		if newInterval > 0 && newInterval != pollInterval {
@@ -52,80 +77,137 @@ func notificationLoop() {
 }
 
 // fullRefreshLoop runs a complete repo scan as a safety net
-func fullRefreshLoop() {
+func fullRefreshLoop(ctx context.Context) {
 	interval := defaultFullRefreshInterval
 	if config.FullRefreshInterval > 0 {
 		interval = config.FullRefreshInterval
 	}
 
-	ticker := time.NewTicker(interval)
+	ticker := clock.NewTicker(interval)
 	defer ticker.Stop()
 
-	for range ticker.C {
-		refreshAllRepos()
+	for {
+		select {
+		case <-ticker.C():
+			refreshAllRepos(ctx)
+		case <-ctx.Done():
+			return
+		}
 	}
 }
 
-func pollNotifications() (newInterval time.Duration, err error) {
-	if defaultClient == nil {
+func pollNotifications(ctx context.Context) (newInterval time.Duration, err error) {
+	client := clients.Default()
+	if client == nil {
 		return 0, fmt.Errorf("no default client configured")
 	}
 
-	ctx := context.Background()
-
 	// Build request manually to set If-Modified-Since
-	req, err := defaultClient.NewRequest("GET", "notifications", nil)
+	req, err := client.NewRequest("GET", "notifications", nil)
 	if err != nil {
 		return 0, fmt.Errorf("creating request: %w", err)
 	}
 
-	if lastMod := dbGetState("notifications_last_modified"); lastMod != "" {
+	if lastMod := store.GetState("notifications_last_modified"); lastMod != "" {
 		req.Header.Set("If-Modified-Since", lastMod)
 	}
 
+	// In preserve mode threads stay unread, so include read ones too (the user
+	// may have read them on GitHub) and only ask for what changed since last time
+	opts := &github.NotificationListOptions{}
+	if preserveNotifications() {
+		opts.All = true
+		opts.Since = notificationsSince()
+		q := req.URL.Query()
+		q.Set("all", "true")
+		q.Set("since", opts.Since.Format(time.RFC3339))
+		req.URL.RawQuery = q.Encode()
+	}
+
 	var notifications []*github.Notification
-	resp, err := defaultClient.Do(ctx, req, &notifications)
+	resp, err := client.Do(ctx, req, &notifications)
 	if err != nil {
 		if resp != nil && resp.StatusCode == http.StatusNotModified {
+			metrics.notificationPoll("not_modified")
 			return 0, nil
 		}
+		metrics.notificationPoll("error")
 		return 0, fmt.Errorf("fetching notifications: %w", err)
 	}
-
-	// Store Last-Modified for next conditional request
-	if lm := resp.Header.Get("Last-Modified"); lm != "" {
-		dbSetState("notifications_last_modified", lm)
-	}
+	metrics.notificationPoll("modified")
 
 	// Respect X-Poll-Interval from GitHub
 	if pi := resp.Header.Get("X-Poll-Interval"); pi != "" {
 		if secs, err := strconv.Atoi(pi); err == nil && secs > 0 {
 			newInterval = time.Duration(secs) * time.Second
-			dbSetState("notifications_poll_interval", pi)
+			store.SetState("notifications_poll_interval", pi)
 		}
 	}
 
 	// For paginated results, fetch remaining pages
+	var pageErr error
 	if resp.NextPage != 0 {
-		remaining, err := fetchRemainingNotificationPages(ctx, resp.NextPage)
-		if err != nil {
-			log.Printf("Warning: failed to fetch remaining notification pages: %v", err)
-		}
+		var remaining []*github.Notification
+		remaining, pageErr = fetchRemainingNotificationPages(ctx, client, opts, resp.NextPage)
 		notifications = append(notifications, remaining...)
 	}
 
 	processNotifications(ctx, notifications)
+	if ctx.Err() != nil {
+		return 0, ctx.Err()
+	}
+
+	// Leave the cursors where they were so the next poll asks for the pages
+	// that failed again; the processed thread table skips what was handled
+	if pageErr != nil {
+		return newInterval, fmt.Errorf("fetching remaining notification pages: %w", pageErr)
+	}
+
+	// Store Last-Modified for next conditional request
+	if lm := resp.Header.Get("Last-Modified"); lm != "" {
+		store.SetState("notifications_last_modified", lm)
+	}
+	if preserveNotifications() {
+		advanceNotificationsSince(notifications)
+	}
+	if err := store.PruneProcessedThreads(clock.Now().Add(-processedThreadRetention)); err != nil {
+		dbLog().Warn("Failed to prune processed notification threads", "err", err)
+	}
+
 	return newInterval, nil
 }
 
-func fetchRemainingNotificationPages(ctx context.Context, startPage int) ([]*github.Notification, error) {
-	var all []*github.Notification
-	opts := &github.NotificationListOptions{
-		ListOptions: github.ListOptions{PerPage: 50, Page: startPage},
+// notificationsSince returns the lower bound for notification updates to fetch
+// in preserve mode. On first use it starts from the PR age cutoff.
+func notificationsSince() time.Time {
+	if stored := store.GetState("notifications_since"); stored != "" {
+		if t, err := time.Parse(time.RFC3339, stored); err == nil {
+			return t
+		}
 	}
+	return clock.Now().Add(-time.Duration(config.MaxAgeDays) * 24 * time.Hour)
+}
+
+// advanceNotificationsSince moves the since bound to the newest update seen,
+// using GitHub's timestamps so local clock skew doesn't drop updates. Threads
+// updated at exactly that instant are deduplicated by the processed thread table.
+func advanceNotificationsSince(notifications []*github.Notification) {
+	latest := notificationsSince()
+	for _, n := range notifications {
+		if t := n.GetUpdatedAt().Time; t.After(latest) {
+			latest = t
+		}
+	}
+	store.SetState("notifications_since", latest.UTC().Format(time.RFC3339))
+}
+
+func fetchRemainingNotificationPages(ctx context.Context, client *github.Client, base *github.NotificationListOptions, startPage int) ([]*github.Notification, error) {
+	var all []*github.Notification
+	opts := *base
+	opts.ListOptions = github.ListOptions{PerPage: 50, Page: startPage}
 
 	for {
-		notifications, resp, err := defaultClient.Activity.ListNotifications(ctx, opts)
+		notifications, resp, err := client.Activity.ListNotifications(ctx, &opts)
 		if err != nil {
 			return all, err
 		}
@@ -140,166 +222,182 @@ func fetchRemainingNotificationPages(ctx context.Context, startPage int) ([]*git
 
 func processNotifications(ctx context.Context, notifications []*github.Notification) {
 	repoSet := makeRepoSet()
-	authorSet := make(map[string]bool)
-	for _, a := range config.Authors {
-		authorSet[a] = true
-	}
 	var updated bool
 
 	for _, n := range notifications {
+		// Threads outside the configured repos are none of our business; leave them untouched
 		if n.GetSubject().GetType() != "PullRequest" || !repoSet[n.GetRepository().GetFullName()] {
-			markThreadRead(ctx, n.GetID())
+			continue
+		}
+
+		if store.ThreadProcessed(n.GetID(), n.GetUpdatedAt().Time) {
 			continue
 		}
 
 		repo := n.GetRepository().GetFullName()
 		prNumber, err := extractPRNumber(n.GetSubject().GetURL())
 		if err != nil {
-			log.Printf("Warning: couldn't extract PR number from %s: %v", n.GetSubject().GetURL(), err)
-			markThreadRead(ctx, n.GetID())
+			pollerLog().Warn("Couldn't extract PR number", "url", n.GetSubject().GetURL(), "err", err)
+			finishThread(ctx, n)
 			continue
 		}
 
-		if dbIsIgnored(repo, prNumber) {
-			markThreadRead(ctx, n.GetID())
-			continue
+		pollerLog().Debug("Processing notification", prAttr(repo, prNumber), "reason", n.GetReason())
+		if processPRUpdate(ctx, repo, prNumber, n.GetReason()) {
+			updated = true
 		}
-
-		owner, repoName := parseRepo(repo)
-		client := getClientForOrg(owner)
-		if client == nil {
-			markThreadRead(ctx, n.GetID())
-			continue
+		if ctx.Err() != nil {
+			// Interrupted by shutdown; leave the thread to be processed next time
+			break
 		}
 
-		pr, _, err := client.PullRequests.Get(ctx, owner, repoName, prNumber)
-		if err != nil {
-			log.Printf("Error fetching PR %s#%d: %v", repo, prNumber, err)
-			markThreadRead(ctx, n.GetID())
-			continue
-		}
+		finishThread(ctx, n)
+	}
 
-		if dbIsMuted(repo, prNumber) {
-			if isReviewRequestedForUser(pr) {
-				log.Printf("Un-muting %s#%d: review re-requested", repo, prNumber)
-				dbUnmutePR(repo, prNumber)
-			} else {
-				markThreadRead(ctx, n.GetID())
-				continue
-			}
-		}
+	if updated {
+		reloadPRsFromDB()
+	}
+}
 
-		if pr.GetState() != "open" || pr.GetDraft() || !authorSet[pr.GetUser().GetLogin()] {
-			dbRemovePR(repo, prNumber)
-			updated = true
-			markThreadRead(ctx, n.GetID())
-			continue
-		}
+// processPRUpdate re-evaluates a single PR after something happened to it
+// (a notification or a webhook event) and updates the database. reason is the
+// notification reason, if known. Returns true if the stored PRs changed.
+func processPRUpdate(ctx context.Context, repo string, prNumber int, reason string) bool {
+	if store.IsIgnored(repo, prNumber) {
+		return false
+	}
 
-		needsReview, needsReapproval, currentUserReviewed := checkReviewStatus(ctx, client, owner, repoName, pr)
-		if needsReview || needsReapproval {
-			if currentUserReviewed && !isReviewRequestedForUser(pr) {
-				log.Printf("Auto-muting %s#%d: current user already reviewed", repo, prNumber)
-				dbMutePR(repo, prNumber)
-				updated = true
-			} else {
-				prInfo := PRInfo{
-					Repo:            repo,
-					Number:          pr.GetNumber(),
-					Title:           pr.GetTitle(),
-					Author:          pr.GetUser().GetLogin(),
-					URL:             pr.GetHTMLURL(),
-					NeedsReview:     needsReview,
-					NeedsReapproval: needsReapproval,
-				}
-				if err := dbSavePR(prInfo); err != nil {
-					log.Printf("Error saving PR %s#%d: %v", repo, prNumber, err)
-				}
-				updated = true
-			}
-		} else {
-			dbRemovePR(repo, prNumber)
-			updated = true
+	owner, repoName := parseRepo(repo)
+	client := getClientForOrg(owner)
+	if client == nil {
+		return false
+	}
+
+	pr, _, err := client.PullRequests.Get(ctx, owner, repoName, prNumber)
+	if err != nil {
+		pollerLog().Error("Error fetching PR", prAttr(repo, prNumber), "err", err)
+		return false
+	}
+
+	if store.IsMuted(repo, prNumber) {
+		switch {
+		case isReviewRequestedForUser(pr):
+			pollerLog().Info("Un-muting: review re-requested", prAttr(repo, prNumber))
+			store.UnmutePR(repo, prNumber)
+		case isFollowUpReason(reason) && checkFollowUp(ctx, client, owner, repoName, pr):
+			pollerLog().Info("Resurfacing: author followed up on your review threads", prAttr(repo, prNumber))
+			store.UnmutePR(repo, prNumber)
+			store.SetFollowUp(repo, prNumber, true)
+		default:
+			return false
 		}
+	}
 
-		markThreadRead(ctx, n.GetID())
+	authorSet := make(map[string]bool)
+	for _, a := range config.Authors {
+		authorSet[a] = true
 	}
 
-	if updated {
-		reloadPRsFromDB()
+	if pr.GetState() != "open" || pr.GetDraft() || !authorSet[pr.GetUser().GetLogin()] {
+		store.RemovePR(repo, prNumber)
+		return true
+	}
+
+	followUp := store.IsFollowUp(repo, prNumber)
+	if _, ok := handedOff(repo, pr); ok && !followUp {
+		store.RemovePR(repo, prNumber)
+		return true
+	}
+
+	needsReview, needsReapproval, currentUserReviewed := checkReviewStatus(ctx, client, owner, repoName, pr)
+	if !needsReview && !needsReapproval && !followUp {
+		store.RemovePR(repo, prNumber)
+		return true
 	}
+
+	if currentUserReviewed && !isReviewRequestedForUser(pr) && !followUp {
+		pollerLog().Info("Auto-muting: current user already reviewed", prAttr(repo, prNumber))
+		store.MutePR(repo, prNumber)
+		return true
+	}
+
+	prInfo := PRInfo{
+		Repo:            repo,
+		Number:          pr.GetNumber(),
+		Title:           pr.GetTitle(),
+		Author:          pr.GetUser().GetLogin(),
+		URL:             pr.GetHTMLURL(),
+		NeedsReview:     needsReview,
+		NeedsReapproval: needsReapproval,
+		FollowUp:        followUp,
+		Reason:          prReason(pr, reason, store.PRReason(repo, prNumber)),
+	}
+	if err := store.SavePR(prInfo); err != nil {
+		dbLog().Error("Error saving PR", prAttr(repo, prNumber), "err", err)
+	}
+	return true
 }
 
-func initialNotificationCleanup() error {
-	if dbGetState("initial_cleanup_done") == "true" {
+// initialNotificationCleanup marks the unread PR threads from configured
+// repos read on first run in mark_read mode, so the queue starts from a clean
+// slate. Other notifications are left alone. Preserve mode skips it.
+func initialNotificationCleanup(ctx context.Context) error {
+	if preserveNotifications() || store.GetState("initial_cleanup_done") == "true" {
 		return nil
 	}
 
-	if defaultClient == nil {
+	client := clients.Default()
+	if client == nil {
 		return fmt.Errorf("no default client for notification cleanup")
 	}
 
-	log.Println("Running initial notification cleanup...")
-	ctx := context.Background()
+	pollerLog().Info("Running initial notification cleanup")
 
-	// Fetch all notifications (including read ones)
-	var all []*github.Notification
-	opts := &github.NotificationListOptions{
-		All:         true,
-		ListOptions: github.ListOptions{PerPage: 50},
-	}
+	var unread []*github.Notification
+	opts := &github.NotificationListOptions{ListOptions: github.ListOptions{PerPage: 50}}
 	for {
-		notifications, resp, err := defaultClient.Activity.ListNotifications(ctx, opts)
+		notifications, resp, err := client.Activity.ListNotifications(ctx, opts)
 		if err != nil {
-			return fmt.Errorf("fetching all notifications: %w", err)
+			return fmt.Errorf("fetching notifications: %w", err)
 		}
-		all = append(all, notifications...)
+		unread = append(unread, notifications...)
 		if resp.NextPage == 0 {
 			break
 		}
 		opts.Page = resp.NextPage
 	}
 
-	log.Printf("Found %d total notifications", len(all))
-
-	// Process PR notifications for configured repos
 	repoSet := makeRepoSet()
-	var prCount int
-	for _, n := range all {
-		if n.GetSubject().GetType() != "PullRequest" {
-			continue
-		}
-		repo := n.GetRepository().GetFullName()
-		if !repoSet[repo] {
+	var marked int
+	for _, n := range unread {
+		if n.GetSubject().GetType() != "PullRequest" || !repoSet[n.GetRepository().GetFullName()] {
 			continue
 		}
-		prCount++
-	}
-	log.Printf("Found %d PR notifications for configured repos", prCount)
-
-	// Mark all notifications as read
-	now := time.Now()
-	ts := github.Timestamp{Time: now}
-	_, err := defaultClient.Activity.MarkNotificationsRead(ctx, ts)
-	if err != nil {
-		log.Printf("Warning: failed to mark all notifications as read: %v", err)
-	} else {
-		log.Println("Marked all notifications as read")
+		markThreadRead(ctx, n.GetID())
+		marked++
 	}
+	pollerLog().Info("Marked PR notifications for configured repos as read", "count", marked, "unread", len(unread))
 
-	return dbSetState("initial_cleanup_done", "true")
+	return store.SetState("initial_cleanup_done", "true")
 }
 
+// reloadMutex serializes reloads so a slow reload can't overwrite the PR list
+// with an older snapshot than a concurrent one already loaded.
+var reloadMutex sync.Mutex
+
 // reloadPRsFromDB refreshes the in-memory PR list from the database
 func reloadPRsFromDB() {
-	dbPRs, err := dbLoadActivePRs()
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+
+	dbPRs, err := store.LoadActivePRs()
 	if err != nil {
-		log.Printf("Error loading PRs from DB: %v", err)
+		dbLog().Error("Error loading PRs", "err", err)
 		return
 	}
 
 	prsMutex.Lock()
-	prs = dbPRs
+	prs = visiblePRs(dbPRs)
 	prsMutex.Unlock()
 
 	updateMenu()
@@ -322,51 +420,69 @@ func extractPRNumber(apiURL string) (int, error) {
 	return strconv.Atoi(parts[len(parts)-1])
 }
 
+// finishThread records a notification thread update as processed and, in
+// mark_read mode, marks it read on GitHub.
+func finishThread(ctx context.Context, n *github.Notification) {
+	if err := store.MarkThreadProcessed(n.GetID(), n.GetUpdatedAt().Time); err != nil {
+		dbLog().Warn("Failed to record notification thread", "thread", n.GetID(), "err", err)
+	}
+	if !preserveNotifications() {
+		markThreadRead(ctx, n.GetID())
+	}
+}
+
 func markThreadRead(ctx context.Context, threadID string) {
-	if _, err := defaultClient.Activity.MarkThreadRead(ctx, threadID); err != nil {
-		log.Printf("Warning: failed to mark thread %s as read: %v", threadID, err)
+	if _, err := clients.Default().Activity.MarkThreadRead(ctx, threadID); err != nil {
+		pollerLog().Warn("Failed to mark thread as read", "thread", threadID, "err", err)
 	}
 }
 
 // validateNotificationAccess checks if the token has notification scope
-func validateNotificationAccess() bool {
-	if defaultClient == nil {
+func validateNotificationAccess(ctx context.Context) bool {
+	client := clients.Default()
+	if client == nil {
 		return false
 	}
 
-	ctx := context.Background()
 	opts := &github.NotificationListOptions{
 		ListOptions: github.ListOptions{PerPage: 1},
 	}
-	_, resp, err := defaultClient.Activity.ListNotifications(ctx, opts)
+	_, resp, err := client.Activity.ListNotifications(ctx, opts)
 	if err != nil {
 		if resp != nil && (resp.StatusCode == http.StatusForbidden || resp.StatusCode == http.StatusUnauthorized) {
-			log.Println("GitHub token needs 'notifications' scope. Update your token at https://github.com/settings/tokens")
+			pollerLog().Warn("GitHub token needs 'notifications' scope. Update your token at https://github.com/settings/tokens")
 			return false
 		}
-		log.Printf("Warning: notification access check failed: %v", err)
+		pollerLog().Warn("Notification access check failed", "err", err)
 		return false
 	}
 
 	// Store initial poll interval from response
 	if pi := resp.Header.Get("X-Poll-Interval"); pi != "" {
-		dbSetState("notifications_poll_interval", pi)
+		store.SetState("notifications_poll_interval", pi)
 	}
 
 	return true
 }
 
 // legacySchedulerLoop is the fallback when notifications aren't available
-func legacySchedulerLoop() {
-	refreshAllRepos()
+func legacySchedulerLoop(ctx context.Context) {
+	refreshAllRepos(ctx)
 
 	interval := defaultFullRefreshInterval
 	if config.FullRefreshInterval > 0 {
 		interval = config.FullRefreshInterval
 	}
 
-	ticker := time.NewTicker(interval)
-	for range ticker.C {
-		refreshAllRepos()
+	ticker := clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			refreshAllRepos(ctx)
+		case <-ctx.Done():
+			return
+		}
 	}
 }
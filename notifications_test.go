@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestNotificationSavesPRAndMarksRead(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.addPR(1, "alice")
+	gh.notifications = []*github.Notification{
+		prNotification("100", "acme/api", 1, "review_requested", testNow),
+		prNotification("200", "other/repo", 5, "review_requested", testNow),
+	}
+
+	if _, err := pollNotifications(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := prNumbers(t); len(got) != 1 || got[0] != 1 {
+		t.Fatalf("listed PRs = %v, want [1]", got)
+	}
+	if got := gh.markedRead(); !slices.Equal(got, []string{"100"}) {
+		t.Errorf("threads marked read = %v, want [100]", got)
+	}
+}
+
+func TestPreserveModeLeavesThreadsUnread(t *testing.T) {
+	gh, _ := setupTest(t)
+	config.NotificationMode = notificationModePreserve
+	gh.addPR(1, "alice")
+	gh.notifications = []*github.Notification{
+		prNotification("100", "acme/api", 1, "review_requested", testNow),
+	}
+
+	for range 2 {
+		if _, err := pollNotifications(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got := gh.markedRead(); len(got) != 0 {
+		t.Errorf("threads marked read = %v, want none", got)
+	}
+	// The second poll sees the same thread update and must not fetch the PR again
+	if n := gh.requestCount("GET", "/repos/acme/api/pulls/1"); n != 1 {
+		t.Errorf("PR fetched %d times, want 1", n)
+	}
+	if got := prNumbers(t); len(got) != 1 {
+		t.Errorf("listed PRs = %v, want [1]", got)
+	}
+}
+
+func TestNotificationRemovesClosedAndDraftPRs(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.addPR(1, "alice")
+	gh.addPR(2, "bob")
+	refreshAllRepos(t.Context())
+	if got := prNumbers(t); len(got) != 2 {
+		t.Fatalf("listed PRs = %v, want [1 2]", got)
+	}
+
+	gh.update(1, func(pr *github.PullRequest) { pr.State = github.String("closed") })
+	gh.update(2, func(pr *github.PullRequest) { pr.Draft = github.Bool(true) })
+
+	processNotifications(context.Background(), []*github.Notification{
+		prNotification("100", "acme/api", 1, "subscribed", testNow),
+		prNotification("101", "acme/api", 2, "subscribed", testNow),
+	})
+
+	if got := prNumbers(t); len(got) != 0 {
+		t.Errorf("listed PRs = %v, want none", got)
+	}
+}
+
+func TestFollowUpResurfacesMutedPR(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.addPR(1, "alice")
+	gh.addReview(1, "me", "COMMENTED", testNow.Add(-30*time.Minute))
+	refreshAllRepos(t.Context())
+	if !store.IsMuted("acme/api", 1) {
+		t.Fatal("PR was not muted after review")
+	}
+
+	gh.setThreads(1, fakeThread{ID: "T1", Comments: []fakeComment{
+		{Author: "me", At: testNow.Add(-30 * time.Minute)},
+		{Author: "alice", At: testNow.Add(-5 * time.Minute)},
+	}})
+
+	processNotifications(context.Background(), []*github.Notification{
+		prNotification("100", "acme/api", 1, "comment", testNow),
+	})
+
+	if store.IsMuted("acme/api", 1) {
+		t.Error("PR is still muted after the author replied")
+	}
+	if got := prNumbers(t); len(got) != 1 || !prs[0].FollowUp {
+		t.Errorf("listed PRs = %v, want [1] marked as follow-up", got)
+	}
+}
+
+func TestInitialCleanupOnlyMarksMonitoredPRThreads(t *testing.T) {
+	gh, _ := setupTest(t)
+	issue := prNotification("300", "acme/api", 9, "mention", testNow)
+	issue.Subject.Type = github.String("Issue")
+	gh.notifications = []*github.Notification{
+		prNotification("100", "acme/api", 1, "review_requested", testNow),
+		prNotification("200", "other/repo", 5, "review_requested", testNow),
+		issue,
+	}
+
+	if err := initialNotificationCleanup(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := gh.markedRead(); !slices.Equal(got, []string{"100"}) {
+		t.Errorf("threads marked read = %v, want only the monitored PR thread", got)
+	}
+	if n := gh.requestCount("PUT", "/notifications"); n != 0 {
+		t.Errorf("marked the whole inbox read %d times", n)
+	}
+	if store.GetState("initial_cleanup_done") != "true" {
+		t.Error("cleanup should only run once")
+	}
+}
+
+func TestPreserveModeRetriesFailedNotificationPages(t *testing.T) {
+	gh, _ := setupTest(t)
+	config.NotificationMode = notificationModePreserve
+	gh.addPR(1, "alice")
+	gh.addPR(2, "bob")
+	gh.maxPerPage = 1
+	gh.failNotificationPages = true
+	gh.notifications = []*github.Notification{
+		prNotification("100", "acme/api", 1, "review_requested", testNow),
+		prNotification("200", "acme/api", 2, "review_requested", testNow.Add(-time.Hour)),
+	}
+	since := store.GetState("notifications_since")
+
+	if _, err := pollNotifications(t.Context()); err == nil {
+		t.Fatal("expected the failed page to be reported")
+	}
+	if got := store.GetState("notifications_since"); got != since {
+		t.Errorf("notifications_since moved to %q after a page failed; page 2 would never be asked for again", got)
+	}
+
+	gh.failNotificationPages = false
+	if _, err := pollNotifications(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if got := prNumbers(t); len(got) != 2 {
+		t.Errorf("listed PRs = %v, want both once the page loads", got)
+	}
+	if n := gh.requestCount("GET", "/repos/acme/api/pulls/1"); n != 1 {
+		t.Errorf("PR 1 fetched %d times, want 1; it was already handled", n)
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// URLs open with open.orgs[<org>] for PRs in that org (say, a work browser
+// profile), otherwise open.command, otherwise the system's handler. Handlers
+// that aren't installed are skipped in that order, so a missing one degrades
+// to the next instead of failing.
+//
+// PR links go to the conversation, the "Files changed" tab or the first
+// comment posted since you last opened the PR from the menu.
+
+const (
+	linkConversation = "conversation"
+	linkFiles        = "files"
+	linkUnread       = "unread"
+)
+
+type OpenConfig struct {
+	Command []string            `yaml:"command"`
+	Orgs    map[string][]string `yaml:"orgs"`
+	Link    string              `yaml:"link"` // conversation (default), files or unread
+}
+
+func validateOpenConfig() error {
+	o := config.Open
+	if len(o.Command) > 0 && !containsPlaceholder(o.Command, "{url}") {
+		return fmt.Errorf("open.command must include {url}")
+	}
+	for org, cmd := range o.Orgs {
+		if len(cmd) == 0 || !containsPlaceholder(cmd, "{url}") {
+			return fmt.Errorf("open.orgs.%s must include {url}", org)
+		}
+	}
+	switch o.Link {
+	case "", linkConversation, linkFiles, linkUnread:
+		return nil
+	}
+	return fmt.Errorf("invalid open.link %q: expected conversation, files or unread", o.Link)
+}
+
+// openPR opens pr at link (open.link if empty) and rechecks it on the usual
+// schedule.
+func openPR(pr PRInfo, link string) {
+	if link == "" {
+		link = config.Open.Link
+	}
+
+	url := pr.URL
+	switch link {
+	case linkFiles:
+		url = strings.TrimSuffix(pr.URL, "/") + "/files"
+	case linkUnread:
+		ctx, cancel := context.WithTimeout(appCtx, 15*time.Second)
+		url = firstUnreadCommentURL(ctx, pr)
+		cancel()
+	}
+
+	// Comments up to now count as read next time
+	store.SetState(openedStateKey(pr), clock.Now().UTC().Format(time.RFC3339))
+
+	owner, _ := parseRepo(pr.Repo)
+	openURLFor(owner, url)
+	scheduleRecheck(pr)
+}
+
+func openedStateKey(pr PRInfo) string {
+	return "opened:" + pr.Key()
+}
+
+// firstUnreadCommentURL links to the earliest comment, review comment or
+// review by someone else since you last opened or reviewed pr. Without one,
+// or if GitHub can't be reached, it's the PR itself.
+func firstUnreadCommentURL(ctx context.Context, pr PRInfo) string {
+	owner, repoName := parseRepo(pr.Repo)
+	client := getClientForOrg(owner)
+	if client == nil {
+		return pr.URL
+	}
+
+	seen, _ := time.Parse(time.RFC3339, store.GetState(openedStateKey(pr)))
+	reviews, err := listAllReviews(ctx, client, owner, repoName, pr.Number)
+	if err != nil {
+		uiLog().Warn("Failed to find unread comments", prAttr(pr.Repo, pr.Number), "err", err)
+		return pr.URL
+	}
+	for _, r := range reviews {
+		if r.GetUser().GetLogin() == currentUser && r.GetSubmittedAt().After(seen) {
+			seen = r.GetSubmittedAt().Time
+		}
+	}
+
+	var firstAt time.Time
+	first := ""
+	consider := func(author string, at time.Time, url string) {
+		if author == currentUser || !at.After(seen) || url == "" {
+			return
+		}
+		if first == "" || at.Before(firstAt) {
+			first, firstAt = url, at
+		}
+	}
+
+	for _, r := range reviews {
+		if r.GetBody() != "" {
+			consider(r.GetUser().GetLogin(), r.GetSubmittedAt().Time, r.GetHTMLURL())
+		}
+	}
+	comments, err := listIssueCommentsSince(ctx, client, owner, repoName, pr.Number, seen)
+	if err != nil {
+		uiLog().Warn("Failed to find unread comments", prAttr(pr.Repo, pr.Number), "err", err)
+		return pr.URL
+	}
+	for _, c := range comments {
+		consider(c.GetUser().GetLogin(), c.GetCreatedAt().Time, c.GetHTMLURL())
+	}
+	reviewComments, err := listReviewCommentsSince(ctx, client, owner, repoName, pr.Number, seen)
+	if err != nil {
+		uiLog().Warn("Failed to find unread comments", prAttr(pr.Repo, pr.Number), "err", err)
+		return pr.URL
+	}
+	for _, c := range reviewComments {
+		consider(c.GetUser().GetLogin(), c.GetCreatedAt().Time, c.GetHTMLURL())
+	}
+
+	if first == "" {
+		uiLog().Debug("No unread comments, opening the PR", prAttr(pr.Repo, pr.Number))
+		return pr.URL
+	}
+	return first
+}
+
+// listIssueCommentsSince pages through a PR's conversation comments updated
+// after since (all of them if since is zero).
+func listIssueCommentsSince(ctx context.Context, client *github.Client, owner, repo string, number int, since time.Time) ([]*github.IssueComment, error) {
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	if !since.IsZero() {
+		opts.Since = &since
+	}
+	var all []*github.IssueComment
+	for {
+		page, resp, err := client.Issues.ListComments(ctx, owner, repo, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+		if resp.NextPage == 0 {
+			return all, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// listReviewCommentsSince pages through a PR's diff comments updated after
+// since (all of them if since is zero).
+func listReviewCommentsSince(ctx context.Context, client *github.Client, owner, repo string, number int, since time.Time) ([]*github.PullRequestComment, error) {
+	opts := &github.PullRequestListCommentsOptions{Since: since, ListOptions: github.ListOptions{PerPage: 100}}
+	var all []*github.PullRequestComment
+	for {
+		page, resp, err := client.PullRequests.ListComments(ctx, owner, repo, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+		if resp.NextPage == 0 {
+			return all, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// openFile opens a local file with the system's handler for it; open.command
+// and open.orgs are for URLs.
+func openFile(path string) {
+	if !runFirstHandler(systemHandlers(path)) {
+		uiLog().Error("No handler available to open file", "path", path)
+	}
+}
+
+// openURLFor opens url with the first available handler for org.
+func openURLFor(org, url string) {
+	if !runFirstHandler(urlHandlers(org, url)) {
+		uiLog().Error("No handler available to open URL", "url", url)
+	}
+}
+
+// runFirstHandler starts the first of handlers that's installed and starts.
+func runFirstHandler(handlers [][]string) bool {
+	for _, argv := range handlers {
+		if _, err := exec.LookPath(argv[0]); err != nil {
+			uiLog().Warn("Handler not found, trying the next one", "handler", argv[0])
+			continue
+		}
+		cmd := exec.Command(argv[0], argv[1:]...)
+		if err := cmd.Start(); err != nil {
+			uiLog().Warn("Handler failed, trying the next one", "handler", argv[0], "err", err)
+			continue
+		}
+		go cmd.Wait()
+		return true
+	}
+	return false
+}
+
+// urlHandlers lists the commands to try for opening url, most specific first.
+func urlHandlers(org, url string) [][]string {
+	values := map[string]string{"{url}": url}
+	var handlers [][]string
+	if cmd := config.Open.Orgs[org]; len(cmd) > 0 {
+		handlers = append(handlers, expandPlaceholders(cmd, values))
+	}
+	if len(config.Open.Command) > 0 {
+		handlers = append(handlers, expandPlaceholders(config.Open.Command, values))
+	}
+	if runtime.GOOS != "darwin" && runtime.GOOS != "windows" {
+		if browser := strings.Fields(os.Getenv("BROWSER")); len(browser) > 0 {
+			handlers = append(handlers, append(browser, url))
+		}
+	}
+	return append(handlers, systemHandlers(url)...)
+}
+
+// systemHandlers are the platform's default openers for target, a URL or a
+// file.
+func systemHandlers(target string) [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"open", target}}
+	case "windows":
+		return [][]string{{"rundll32", "url.dll,FileProtocolHandler", target}}
+	}
+	return [][]string{{"xdg-open", target}, {"gio", "open", target}}
+}
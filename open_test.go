@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestFirstUnreadCommentURL(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.addPR(7, "alice")
+	pr := PRInfo{Repo: "acme/api", Number: 7, URL: "https://github.com/acme/api/pull/7"}
+	store.SetState(openedStateKey(pr), testNow.Add(-3*time.Hour).Format(time.RFC3339))
+
+	comment := func(user string, at time.Time, url string) *github.IssueComment {
+		return &github.IssueComment{User: &github.User{Login: github.String(user)}, CreatedAt: &github.Timestamp{Time: at}, HTMLURL: github.String(url)}
+	}
+	gh.comments["acme/api#7"] = []*github.IssueComment{
+		comment("bob", testNow.Add(-4*time.Hour), pr.URL+"#issuecomment-1"),
+		comment("me", testNow.Add(-2*time.Hour), pr.URL+"#issuecomment-2"),
+		comment("bob", testNow.Add(-time.Hour), pr.URL+"#issuecomment-3"),
+	}
+	gh.reviewComments["acme/api#7"] = []*github.PullRequestComment{{
+		User:      &github.User{Login: github.String("carol")},
+		CreatedAt: &github.Timestamp{Time: testNow.Add(-90 * time.Minute)},
+		HTMLURL:   github.String(pr.URL + "#discussion_r4"),
+	}}
+
+	if got := firstUnreadCommentURL(t.Context(), pr); got != pr.URL+"#discussion_r4" {
+		t.Errorf("first unread = %s, want carol's review comment (older ones were read, mine don't count)", got)
+	}
+
+	// Reviewing counts as having read everything before it
+	gh.addReview(7, "me", "COMMENTED", testNow.Add(-80*time.Minute))
+	if got := firstUnreadCommentURL(t.Context(), pr); got != pr.URL+"#issuecomment-3" {
+		t.Errorf("first unread after my review = %s, want bob's latest comment", got)
+	}
+
+	store.SetState(openedStateKey(pr), testNow.Format(time.RFC3339))
+	if got := firstUnreadCommentURL(t.Context(), pr); got != pr.URL {
+		t.Errorf("with nothing unread = %s, want the PR", got)
+	}
+}
+
+// urlRecorder points open.command at a script that records the URL it's given.
+func urlRecorder(t *testing.T) (opened func() string) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "opened")
+	stub := filepath.Join(dir, "browser")
+	writeStub(t, stub, `echo "$1" > `+out)
+	config.Open.Command = []string{stub, "{url}"}
+
+	return func() string {
+		var data []byte
+		waitFor(t, "the URL handler to run", func() bool {
+			var err error
+			data, err = os.ReadFile(out)
+			return err == nil && len(data) > 0
+		})
+		return strings.TrimSpace(string(data))
+	}
+}
+
+func TestOpenURLFallsBackToNextHandler(t *testing.T) {
+	setupTest(t)
+	opened := urlRecorder(t)
+	config.Open.Orgs = map[string][]string{"acme": {filepath.Join(t.TempDir(), "missing"), "{url}"}}
+
+	openURLFor("acme", "https://github.com/acme/api/pull/7")
+	if got := opened(); got != "https://github.com/acme/api/pull/7" {
+		t.Errorf("opened %q", got)
+	}
+}
+
+func TestURLHandlersOrder(t *testing.T) {
+	setupTest(t)
+	config.Open.Command = []string{"firefox", "-P", "personal", "{url}"}
+	config.Open.Orgs = map[string][]string{"acme": {"chrome", "--profile-directory=Work", "{url}"}}
+
+	handlers := urlHandlers("acme", "U")
+	if strings.Join(handlers[0], " ") != "chrome --profile-directory=Work U" || strings.Join(handlers[1], " ") != "firefox -P personal U" {
+		t.Errorf("handlers = %v, want the org's first, then open.command", handlers)
+	}
+	if handlers := urlHandlers("other", "U"); handlers[0][0] != "firefox" {
+		t.Errorf("handlers for another org = %v, want open.command first", handlers)
+	}
+	if len(handlers) < 3 {
+		t.Errorf("handlers = %v, want the system handler as a last resort", handlers)
+	}
+}
+
+func TestOpenFileUsesSystemHandler(t *testing.T) {
+	setupTest(t)
+	if runtime.GOOS != "linux" {
+		t.Skip("stubs xdg-open")
+	}
+	config.Open.Command = []string{"false", "{url}"}
+	bin := t.TempDir()
+	out := filepath.Join(bin, "opened")
+	writeStub(t, filepath.Join(bin, "xdg-open"), `echo "$1" > `+out)
+	t.Setenv("PATH", bin+":"+os.Getenv("PATH"))
+	t.Setenv("BROWSER", "false")
+
+	openFile("/tmp/pr-monitor.log")
+	waitFor(t, "xdg-open to run", func() bool {
+		data, _ := os.ReadFile(out)
+		return strings.TrimSpace(string(data)) == "/tmp/pr-monitor.log"
+	})
+}
+
+func TestOpenPRFilesChanged(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.addPR(7, "alice")
+	opened := urlRecorder(t)
+	pr := PRInfo{Repo: "acme/api", Number: 7, URL: "https://github.com/acme/api/pull/7"}
+
+	openPR(pr, linkFiles)
+	if got := opened(); got != pr.URL+"/files" {
+		t.Errorf("opened %q, want the Files changed tab", got)
+	}
+	if store.GetState(openedStateKey(pr)) == "" {
+		t.Error("opening a PR should record when it was last opened")
+	}
+}
+
+func TestValidateOpenConfig(t *testing.T) {
+	setupTest(t)
+	for _, o := range []OpenConfig{
+		{Command: []string{"firefox"}},
+		{Orgs: map[string][]string{"acme": {"chrome"}}},
+		{Orgs: map[string][]string{"acme": nil}},
+		{Link: "diff"},
+	} {
+		config.Open = o
+		if err := validateOpenConfig(); err == nil {
+			t.Errorf("%+v should be invalid", o)
+		}
+	}
+}
@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Previews show a PR's description, review state and diff without opening
+// the browser: `pr-monitor preview` pages a coloured rendering in the
+// terminal, and with preview.listen set the tray's "Preview" item opens the
+// same thing as an HTML page served locally.
+
+type PreviewConfig struct {
+	Listen string `yaml:"listen"`
+}
+
+func previewEnabled() bool {
+	return config.Preview.Listen != ""
+}
+
+// validatePreviewConfig keeps previews, which have no authentication and
+// show private PRs with your tokens, on a loopback address, and off any port
+// another listener exposes beyond this machine.
+func validatePreviewConfig() error {
+	if !previewEnabled() {
+		return nil
+	}
+	host, port, err := net.SplitHostPort(config.Preview.Listen)
+	if err != nil {
+		return fmt.Errorf("preview.listen: %w", err)
+	}
+	if !isLoopbackHost(host) {
+		return fmt.Errorf("preview.listen must be a loopback address such as 127.0.0.1:%s, got %q", port, config.Preview.Listen)
+	}
+	for name, listen := range map[string]string{"webhook.listen": config.Webhook.Listen, "metrics.listen": config.Metrics.Listen} {
+		otherHost, otherPort, err := net.SplitHostPort(listen)
+		if err != nil || otherPort != port {
+			continue
+		}
+		// The webhook is meant to be reachable by GitHub, so never share it
+		if name == "webhook.listen" || !isLoopbackHost(otherHost) {
+			return fmt.Errorf("preview.listen can't share a port with %s (%s)", name, listen)
+		}
+	}
+	return nil
+}
+
+func isLoopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// previewHostAllowed guards against DNS rebinding: a page on another site
+// can't read previews through a name that resolves to this machine, because
+// its requests carry that name as Host.
+func previewHostAllowed(hostport string) bool {
+	host, _, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+	}
+	return isLoopbackHost(host)
+}
+
+type prPreview struct {
+	Repo      string
+	Number    int
+	Title     string
+	Author    string
+	State     string // open, closed, merged or draft
+	URL       string
+	Body      string
+	BaseRef   string
+	HeadRef   string
+	Additions int
+	Deletions int
+	Reviews   []reviewerState
+	Requested []string
+	Files     []previewFile
+}
+
+type reviewerState struct {
+	Login string
+	State string // APPROVED, CHANGES_REQUESTED, COMMENTED or DISMISSED
+}
+
+type previewFile struct {
+	Filename  string
+	Status    string
+	Additions int
+	Deletions int
+	// Lines is empty when GitHub leaves the patch out, e.g. for binary or
+	// very large files
+	Lines []diffLine
+}
+
+type diffLine struct {
+	Kind string // add, del, hunk or ctx
+	Text string
+}
+
+func gatherPreview(ctx context.Context, repo string, number int) (prPreview, error) {
+	owner, name := parseRepo(repo)
+	client := getClientForOrg(owner)
+	if client == nil {
+		return prPreview{}, fmt.Errorf("no client available for %s", repo)
+	}
+
+	ghPR, _, err := client.PullRequests.Get(ctx, owner, name, number)
+	if err != nil {
+		return prPreview{}, fmt.Errorf("fetching PR: %w", err)
+	}
+	reviews, err := listAllReviews(ctx, client, owner, name, number)
+	if err != nil {
+		return prPreview{}, fmt.Errorf("fetching reviews: %w", err)
+	}
+	files, err := listAllFiles(ctx, client, owner, name, number)
+	if err != nil {
+		return prPreview{}, fmt.Errorf("fetching changed files: %w", err)
+	}
+
+	p := prPreview{
+		Repo:      repo,
+		Number:    number,
+		Title:     ghPR.GetTitle(),
+		Author:    ghPR.GetUser().GetLogin(),
+		State:     ghPR.GetState(),
+		URL:       ghPR.GetHTMLURL(),
+		Body:      ghPR.GetBody(),
+		BaseRef:   ghPR.GetBase().GetRef(),
+		HeadRef:   ghPR.GetHead().GetRef(),
+		Additions: ghPR.GetAdditions(),
+		Deletions: ghPR.GetDeletions(),
+	}
+	switch {
+	case ghPR.GetMerged():
+		p.State = "merged"
+	case ghPR.GetDraft() && p.State == "open":
+		p.State = "draft"
+	}
+
+	// A reviewer's latest approval or change request stands until they
+	// submit another; later comments don't replace it
+	latest := make(map[string]string)
+	for _, r := range reviews {
+		login, state := r.GetUser().GetLogin(), r.GetState()
+		if state == "PENDING" || (state == "COMMENTED" && latest[login] != "") {
+			continue
+		}
+		latest[login] = state
+	}
+	for _, login := range sortedKeys(latest) {
+		p.Reviews = append(p.Reviews, reviewerState{Login: login, State: latest[login]})
+	}
+
+	for _, u := range ghPR.RequestedReviewers {
+		p.Requested = append(p.Requested, u.GetLogin())
+	}
+	for _, t := range ghPR.RequestedTeams {
+		p.Requested = append(p.Requested, owner+"/"+t.GetSlug())
+	}
+
+	for _, f := range files {
+		p.Files = append(p.Files, previewFile{
+			Filename:  f.GetFilename(),
+			Status:    f.GetStatus(),
+			Additions: f.GetAdditions(),
+			Deletions: f.GetDeletions(),
+			Lines:     parseDiff(f.GetPatch()),
+		})
+	}
+	return p, nil
+}
+
+func parseDiff(patch string) []diffLine {
+	if patch == "" {
+		return nil
+	}
+	var lines []diffLine
+	for _, text := range strings.Split(strings.TrimSuffix(patch, "\n"), "\n") {
+		kind := "ctx"
+		switch {
+		case strings.HasPrefix(text, "@@"):
+			kind = "hunk"
+		case strings.HasPrefix(text, "+"):
+			kind = "add"
+		case strings.HasPrefix(text, "-"):
+			kind = "del"
+		}
+		lines = append(lines, diffLine{Kind: kind, Text: text})
+	}
+	return lines
+}
+
+// ANSI colours for the terminal rendering, by diff line kind and review state.
+var (
+	ansiColors = map[string]string{
+		"add":               "\x1b[32m",
+		"del":               "\x1b[31m",
+		"hunk":              "\x1b[36m",
+		"file":              "\x1b[1m",
+		"APPROVED":          "\x1b[32m",
+		"CHANGES_REQUESTED": "\x1b[31m",
+	}
+	ansiReset = "\x1b[0m"
+)
+
+// writePreviewText renders p for a terminal, coloured if color is set.
+// Control characters from GitHub are stripped so PR content can't drive the
+// terminal.
+func writePreviewText(w io.Writer, p prPreview, color bool) {
+	paint := func(kind, s string) string {
+		s = stripControl(s)
+		if c := ansiColors[kind]; color && c != "" {
+			return c + s + ansiReset
+		}
+		return s
+	}
+
+	fmt.Fprintf(w, "%s\n", paint("file", fmt.Sprintf("%s#%d: %s", p.Repo, p.Number, p.Title)))
+	fmt.Fprintf(w, "@%s wants to merge %s into %s (%s, %s %s)\n",
+		stripControl(p.Author), stripControl(p.HeadRef), stripControl(p.BaseRef), p.State,
+		paint("add", fmt.Sprintf("+%d", p.Additions)), paint("del", fmt.Sprintf("-%d", p.Deletions)))
+	fmt.Fprintf(w, "%s\n", p.URL)
+
+	if len(p.Reviews) > 0 || len(p.Requested) > 0 {
+		fmt.Fprintln(w, "\nReviews:")
+		for _, r := range p.Reviews {
+			fmt.Fprintf(w, "  %-20s %s\n", stripControl(r.Login), paint(r.State, reviewStateLabel(r.State)))
+		}
+		for _, login := range p.Requested {
+			fmt.Fprintf(w, "  %-20s requested\n", stripControl(login))
+		}
+	}
+
+	if body := strings.TrimSpace(p.Body); body != "" {
+		fmt.Fprintf(w, "\n%s\n", stripControl(body))
+	}
+
+	for _, f := range p.Files {
+		fmt.Fprintf(w, "\n%s\n", paint("file", fmt.Sprintf("%s (%s, +%d -%d)", f.Filename, f.Status, f.Additions, f.Deletions)))
+		if len(f.Lines) == 0 {
+			fmt.Fprintln(w, "  (no diff available)")
+		}
+		for _, l := range f.Lines {
+			fmt.Fprintln(w, paint(l.Kind, l.Text))
+		}
+	}
+}
+
+var controlChars = regexp.MustCompile(`[\x00-\x08\x0b-\x1f\x7f]`)
+
+func stripControl(s string) string {
+	return controlChars.ReplaceAllString(s, "")
+}
+
+func reviewStateLabel(state string) string {
+	return strings.ReplaceAll(strings.ToLower(state), "_", " ")
+}
+
+var previewPage = template.Must(template.New("preview").Funcs(template.FuncMap{
+	"stateLabel": reviewStateLabel,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Repo}}#{{.Number}}: {{.Title}}</title>
+<style>
+body { font: 14px -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; margin: 2em auto; max-width: 1100px; padding: 0 1em; color: #1f2328; }
+h1 { font-size: 1.5em; margin-bottom: 0.2em; }
+.meta { color: #59636e; }
+.body { white-space: pre-wrap; background: #f6f8fa; padding: 1em; border-radius: 6px; }
+.APPROVED { color: #1a7f37; } .CHANGES_REQUESTED { color: #d1242f; }
+.file { border: 1px solid #d1d9e0; border-radius: 6px; margin: 1em 0; overflow: hidden; }
+.file h3 { margin: 0; padding: 0.5em 1em; background: #f6f8fa; font: 600 13px ui-monospace, monospace; }
+.file pre { margin: 0; font: 12px ui-monospace, monospace; overflow-x: auto; }
+.file pre span { display: block; padding: 0 1em; }
+.add { background: #dafbe1; } .del { background: #ffebe9; } .hunk { background: #ddf4ff; color: #59636e; }
+</style>
+</head>
+<body>
+<h1>{{.Title}} <span class="meta">#{{.Number}}</span></h1>
+<p class="meta">{{.Repo}} · @{{.Author}} wants to merge <code>{{.HeadRef}}</code> into <code>{{.BaseRef}}</code> · {{.State}} · <span class="add">+{{.Additions}}</span> <span class="del">-{{.Deletions}}</span> · <a href="{{.URL}}">Open on GitHub</a></p>
+{{if or .Reviews .Requested}}<ul>
+{{range .Reviews}}<li>@{{.Login}}: <span class="{{.State}}">{{stateLabel .State}}</span></li>
+{{end}}{{range .Requested}}<li>@{{.}}: requested</li>
+{{end}}</ul>{{end}}
+{{if .Body}}<div class="body">{{.Body}}</div>{{end}}
+{{range .Files}}<div class="file">
+<h3>{{.Filename}} <span class="meta">({{.Status}}, +{{.Additions}} -{{.Deletions}})</span></h3>
+<pre>{{range .Lines}}<span class="{{.Kind}}">{{.Text}}</span>{{else}}<span class="meta">No diff available</span>{{end}}</pre>
+</div>
+{{end}}
+</body>
+</html>
+`))
+
+// handlePreview serves GET /pr/{owner}/{repo}/{number}, for monitored repos only.
+func handlePreview(w http.ResponseWriter, r *http.Request) {
+	if !previewHostAllowed(r.Host) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	repo := r.PathValue("owner") + "/" + r.PathValue("repo")
+	number, err := strconv.Atoi(r.PathValue("number"))
+	if err != nil || !makeRepoSet()[repo] {
+		http.NotFound(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+	p, err := gatherPreview(ctx, repo, number)
+	if err != nil {
+		uiLog().Error("Failed to build preview", prAttr(repo, number), "err", err)
+		http.Error(w, describeAPIError(err), http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := previewPage.Execute(w, p); err != nil {
+		uiLog().Error("Failed to render preview", prAttr(repo, number), "err", err)
+	}
+}
+
+// previewURL is where the running app serves pr's preview.
+func previewURL(pr PRInfo) string {
+	host, port, err := net.SplitHostPort(config.Preview.Listen)
+	if err != nil {
+		return ""
+	}
+	owner, repo := parseRepo(pr.Repo)
+	return (&url.URL{
+		Scheme: "http",
+		Host:   net.JoinHostPort(host, port),
+		Path:   fmt.Sprintf("/pr/%s/%s/%d", owner, repo, pr.Number),
+	}).String()
+}
+
+var prURLPattern = regexp.MustCompile(`^https?://[^/]+/([^/]+/[^/]+)/pull/(\d+)`)
+
+// parsePRRef accepts owner/repo#123 or a PR URL.
+func parsePRRef(s string) (repo string, number int, err error) {
+	if m := prURLPattern.FindStringSubmatch(s); m != nil {
+		number, _ = strconv.Atoi(m[2])
+		return m[1], number, nil
+	}
+	repo, number = parsePRKey(s)
+	if owner, name := parseRepo(repo); owner == "" || name == "" || number <= 0 {
+		return "", 0, fmt.Errorf("invalid PR %q: expected owner/repo#123 or a PR URL", s)
+	}
+	return repo, number, nil
+}
+
+func runPreview(args []string) error {
+	fs := flag.NewFlagSet("preview", flag.ContinueOnError)
+	noPager := fs.Bool("no-pager", false, "write to stdout instead of $PAGER")
+	noColor := fs.Bool("no-color", false, "don't colour the output")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: pr-monitor preview [-no-pager] [-no-color] owner/repo#123")
+	}
+	repo, number, err := parsePRRef(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if err := openClientsForCommand(); err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	p, err := gatherPreview(ctx, repo, number)
+	if err != nil {
+		return err
+	}
+
+	tty := isTerminal(os.Stdout)
+	if !tty || *noPager {
+		writePreviewText(os.Stdout, p, tty && !*noColor)
+		return nil
+	}
+	return page(func(w io.Writer) { writePreviewText(w, p, !*noColor) })
+}
+
+// page pipes render's output through $PAGER (less by default).
+func page(render func(io.Writer)) error {
+	pager := strings.Fields(os.Getenv("PAGER"))
+	if len(pager) == 0 {
+		pager = []string{"less"}
+	}
+	if _, err := exec.LookPath(pager[0]); err != nil {
+		render(os.Stdout)
+		return nil
+	}
+
+	cmd := exec.Command(pager[0], pager[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	// Keep colours, and don't page what fits on one screen
+	if os.Getenv("LESS") == "" {
+		cmd.Env = append(os.Environ(), "LESS=FRX")
+	}
+	in, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	render(in)
+	in.Close()
+	return cmd.Wait()
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
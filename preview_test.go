@@ -0,0 +1,198 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func previewFixture(gh *fakeGitHub) {
+	gh.addPR(7, "alice", requested("me"), func(pr *github.PullRequest) {
+		pr.Title = github.String("Add <retries>")
+		pr.Body = github.String("Retries failed uploads.\x1b]0;pwned\x07")
+		pr.Base = &github.PullRequestBranch{Ref: github.String("main")}
+		pr.Head = &github.PullRequestBranch{Ref: github.String("retries")}
+		pr.RequestedTeams = []*github.Team{{Slug: github.String("backend")}}
+	})
+	gh.addReview(7, "bob", "CHANGES_REQUESTED", testNow.Add(-2*time.Hour))
+	gh.addReview(7, "bob", "COMMENTED", testNow.Add(-time.Hour))
+	gh.addReview(7, "carol", "APPROVED", testNow.Add(-time.Hour))
+	gh.files["acme/api#7"] = []*github.CommitFile{
+		{
+			Filename: github.String("upload.go"), Status: github.String("modified"),
+			Additions: github.Int(1), Deletions: github.Int(1),
+			Patch: github.String("@@ -1,2 +1,2 @@\n package main\n-var retries = 0\n+var retries = 3"),
+		},
+		{Filename: github.String("logo.png"), Status: github.String("added")},
+	}
+}
+
+func TestGatherPreview(t *testing.T) {
+	gh, _ := setupTest(t)
+	previewFixture(gh)
+
+	p, err := gatherPreview(t.Context(), "acme/api", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []reviewerState{{"bob", "CHANGES_REQUESTED"}, {"carol", "APPROVED"}}
+	if len(p.Reviews) != len(want) || p.Reviews[0] != want[0] || p.Reviews[1] != want[1] {
+		t.Errorf("reviews = %v, want %v (a later comment doesn't replace a change request)", p.Reviews, want)
+	}
+	if strings.Join(p.Requested, ",") != "me,acme/backend" {
+		t.Errorf("requested = %v, want me and the backend team", p.Requested)
+	}
+
+	kinds := []string{}
+	for _, l := range p.Files[0].Lines {
+		kinds = append(kinds, l.Kind)
+	}
+	if strings.Join(kinds, ",") != "hunk,ctx,del,add" {
+		t.Errorf("diff line kinds = %v", kinds)
+	}
+	if len(p.Files[1].Lines) != 0 {
+		t.Errorf("a file without a patch should have no diff lines")
+	}
+}
+
+func TestWritePreviewText(t *testing.T) {
+	gh, _ := setupTest(t)
+	previewFixture(gh)
+	p, err := gatherPreview(t.Context(), "acme/api", 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var plain, colored strings.Builder
+	writePreviewText(&plain, p, false)
+	writePreviewText(&colored, p, true)
+
+	for _, want := range []string{
+		"acme/api#7: Add <retries>\n",
+		"@alice wants to merge retries into main",
+		"bob                  changes requested\n",
+		"Retries failed uploads.]0;pwned\n",
+		"upload.go (modified, +1 -1)\n@@ -1,2 +1,2 @@\n package main\n-var retries = 0\n",
+		"logo.png (added, +0 -0)\n  (no diff available)\n",
+	} {
+		if !strings.Contains(plain.String(), want) {
+			t.Errorf("preview missing %q:\n%s", want, plain.String())
+		}
+	}
+	if strings.Contains(plain.String(), "\x1b") || strings.Contains(plain.String(), "\x07") {
+		t.Error("plain preview should contain no escape or control characters")
+	}
+	if !strings.Contains(colored.String(), "\x1b[32m+var retries = 3\x1b[0m") {
+		t.Errorf("added lines should be green:\n%q", colored.String())
+	}
+}
+
+func TestHandlePreview(t *testing.T) {
+	gh, _ := setupTest(t)
+	previewFixture(gh)
+
+	config.Preview.Listen = "127.0.0.1:8081"
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /pr/{owner}/{repo}/{number}", handlePreview)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "http://127.0.0.1:8081/pr/acme/api/7", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"Add &lt;retries&gt;",
+		`<span class="del">-var retries = 0</span>`,
+		`<span class="CHANGES_REQUESTED">changes requested</span>`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("page missing %q", want)
+		}
+	}
+
+	// Only monitored repos are served
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest("GET", "http://127.0.0.1:8081/pr/other/repo/7", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unmonitored repo status = %d, want 404", rec.Code)
+	}
+
+	// Other names for this machine are refused, as a rebinding attack would use
+	for host, want := range map[string]int{
+		"localhost:8081":        http.StatusOK,
+		"[::1]:8081":            http.StatusOK,
+		"attacker.example:8081": http.StatusForbidden,
+		"192.168.1.10:8081":     http.StatusForbidden,
+	} {
+		req := httptest.NewRequest("GET", "/pr/acme/api/7", nil)
+		req.Host = host
+		rec = httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("Host %s: status = %d, want %d", host, rec.Code, want)
+		}
+	}
+}
+
+func TestValidatePreviewConfig(t *testing.T) {
+	setupTest(t)
+	for _, tc := range []struct {
+		preview, webhook, metrics string
+		ok                        bool
+	}{
+		{preview: "127.0.0.1:8790", ok: true},
+		{preview: "localhost:8790", ok: true},
+		{preview: "[::1]:8790", ok: true},
+		{preview: "127.0.0.1:8790", metrics: "127.0.0.1:8790", ok: true},
+		{preview: ":8790"},
+		{preview: "0.0.0.0:8790"},
+		{preview: "192.168.1.10:8790"},
+		{preview: "127.0.0.1"},
+		{preview: "127.0.0.1:8080", webhook: "127.0.0.1:8080"},
+		{preview: "127.0.0.1:8765", webhook: "0.0.0.0:8765"},
+		{preview: "127.0.0.1:9465", metrics: ":9465"},
+	} {
+		config.Preview.Listen, config.Webhook.Listen, config.Metrics.Listen = tc.preview, tc.webhook, tc.metrics
+		if err := validatePreviewConfig(); (err == nil) != tc.ok {
+			t.Errorf("%+v: err = %v, want ok=%v", tc, err, tc.ok)
+		}
+	}
+}
+
+func TestParsePRRef(t *testing.T) {
+	for s, want := range map[string]string{
+		"acme/api#7":                               "acme/api#7",
+		"https://github.com/acme/api/pull/7":       "acme/api#7",
+		"https://github.com/acme/api/pull/7/files": "acme/api#7",
+	} {
+		repo, n, err := parsePRRef(s)
+		if err != nil || (PRInfo{Repo: repo, Number: n}).Key() != want {
+			t.Errorf("parsePRRef(%q) = %s#%d, %v; want %s", s, repo, n, err, want)
+		}
+	}
+	for _, s := range []string{"", "acme/api", "api#7", "acme/api#x"} {
+		if _, _, err := parsePRRef(s); err == nil {
+			t.Errorf("parsePRRef(%q) should fail", s)
+		}
+	}
+}
+
+func TestPreviewURL(t *testing.T) {
+	setupTest(t)
+	for listen, want := range map[string]string{
+		"127.0.0.1:8790": "http://127.0.0.1:8790/pr/acme/api/7",
+		"localhost:8790": "http://localhost:8790/pr/acme/api/7",
+		"[::1]:8790":     "http://[::1]:8790/pr/acme/api/7",
+	} {
+		config.Preview.Listen = listen
+		if got := previewURL(PRInfo{Repo: "acme/api", Number: 7}); got != want {
+			t.Errorf("previewURL with listen %q = %s, want %s", listen, got, want)
+		}
+	}
+}
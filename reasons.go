@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// Reasons record why a PR is on your list, derived from the notification
+// reason GitHub sends and the PR's requested reviewers. They drive the label
+// shown in the menu, ordering, and the silent/hidden filters in config.
+const (
+	reasonDirect  = "direct"
+	reasonTeam    = "team"
+	reasonMention = "mention"
+	reasonOther   = "other"
+)
+
+var validReasons = []string{reasonDirect, reasonTeam, reasonMention, reasonOther}
+
+// prReason works out the reason for pr. notificationReason is the raw reason
+// from the notifications API, or empty when the PR was found by a repo scan.
+// previous is the reason stored from an earlier update, kept when the new
+// information is less specific (e.g. a later "comment" notification).
+func prReason(pr *github.PullRequest, notificationReason, previous string) string {
+	if isReviewRequestedForUser(pr) {
+		return reasonDirect
+	}
+
+	switch notificationReason {
+	case "review_requested", "team_mention":
+		// review_requested is also sent for team requests; direct ones were caught above
+		return reasonTeam
+	case "mention":
+		return reasonMention
+	}
+
+	if previous != "" && previous != reasonDirect {
+		return previous
+	}
+	if len(pr.RequestedTeams) > 0 {
+		return reasonTeam
+	}
+	return ""
+}
+
+// normalizeReason maps the stored empty reason to "other" for config matching.
+func normalizeReason(reason string) string {
+	if reason == "" {
+		return reasonOther
+	}
+	return reason
+}
+
+func reasonLabel(reason string) string {
+	switch reason {
+	case reasonDirect:
+		return "direct"
+	case reasonTeam:
+		return "team"
+	case reasonMention:
+		return "@mention"
+	}
+	return ""
+}
+
+func reasonPriority(reason string) int {
+	switch reason {
+	case reasonDirect:
+		return 0
+	case reasonMention:
+		return 1
+	case reasonTeam:
+		return 2
+	}
+	return 3
+}
+
+func isSilentReason(reason string) bool {
+	return slices.Contains(config.Reasons.Silent, normalizeReason(reason))
+}
+
+func isHiddenReason(reason string) bool {
+	return slices.Contains(config.Reasons.Hidden, normalizeReason(reason))
+}
+
+func validateReasons(reasons []string) error {
+	for _, r := range reasons {
+		if !slices.Contains(validReasons, r) {
+			return fmt.Errorf("unknown reason %q: expected one of %v", r, validReasons)
+		}
+	}
+	return nil
+}
+
+// visiblePRs drops PRs with hidden reasons and orders the rest by reason
+// priority, then repo and number.
+func visiblePRs(all []PRInfo) []PRInfo {
+	result := make([]PRInfo, 0, len(all))
+	for _, pr := range all {
+		if !isHiddenReason(pr.Reason) {
+			result = append(result, pr)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		pi, pj := reasonPriority(result[i].Reason), reasonPriority(result[j].Reason)
+		if pi != pj {
+			return pi < pj
+		}
+		if result[i].Repo != result[j].Repo {
+			return result[i].Repo < result[j].Repo
+		}
+		return result[i].Number < result[j].Number
+	})
+	return result
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// All repo refreshes go through a single coordinator. Only one refresh runs at
+// a time; requests that arrive meanwhile are merged into one follow-up run
+// covering every repo asked for, so a burst of triggers (Refresh Now, clearing
+// ignored PRs, the periodic loops) costs at most one extra scan.
+
+type refreshCoordinator struct {
+	mu      sync.Mutex
+	running bool
+	pending []string        // repos for the next run, in request order
+	queued  map[string]bool // set of pending
+	next    chan struct{}   // closed when the next run finishes
+
+	done, total int // progress of the current run
+}
+
+var refresher = &refreshCoordinator{queued: make(map[string]bool)}
+
+func refreshAllRepos(ctx context.Context) {
+	refreshRepos(ctx, config.Repos)
+}
+
+// refreshRepos refreshes the given repos and waits until they're done, or ctx
+// is cancelled. Repos already waiting for a refresh aren't queued twice.
+func refreshRepos(ctx context.Context, repos []string) {
+	select {
+	case <-refresher.request(repos):
+	case <-ctx.Done():
+	}
+}
+
+// request queues repos for the next run, starting one if none is running, and
+// returns a channel closed once that run has finished.
+func (c *refreshCoordinator) request(repos []string) <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, repo := range repos {
+		if !c.queued[repo] {
+			c.queued[repo] = true
+			c.pending = append(c.pending, repo)
+		}
+	}
+	if c.next == nil {
+		c.next = make(chan struct{})
+	}
+	done := c.next
+
+	if !c.running {
+		c.running = goBackground(c.loop)
+		if !c.running {
+			c.abandon()
+		}
+	}
+	return done
+}
+
+// loop runs queued refreshes until nothing is pending.
+func (c *refreshCoordinator) loop() {
+	for {
+		c.mu.Lock()
+		if appCtx.Err() != nil {
+			c.abandon()
+		}
+		if c.next == nil {
+			c.running = false
+			c.mu.Unlock()
+			return
+		}
+		batch, done := c.pending, c.next
+		c.pending, c.queued, c.next = nil, make(map[string]bool), nil
+		c.done, c.total = 0, len(batch)
+		c.mu.Unlock()
+
+		updateMenu()
+		runRefresh(appCtx, batch, c.repoDone)
+		if err := store.PruneHTTPCache(clock.Now().Add(-httpCacheRetention)); err != nil {
+			dbLog().Warn("Failed to prune HTTP cache", "err", err)
+		}
+
+		c.mu.Lock()
+		c.done, c.total = 0, 0
+		c.mu.Unlock()
+
+		close(done)
+		updateMenu()
+	}
+}
+
+// abandon drops queued work and releases its waiters when shutting down.
+// Must be called with c.mu held.
+func (c *refreshCoordinator) abandon() {
+	if c.next != nil {
+		close(c.next)
+	}
+	c.pending, c.queued, c.next = nil, make(map[string]bool), nil
+}
+
+func (c *refreshCoordinator) repoDone() {
+	c.mu.Lock()
+	c.done++
+	c.mu.Unlock()
+	updateMenu()
+}
+
+// progress reports how many repos the current run has finished out of how
+// many it covers. total is 0 when no refresh is running.
+func (c *refreshCoordinator) progress() (done, total int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.done, c.total
+}
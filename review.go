@@ -0,0 +1,453 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// "Review Locally" checks a PR out into a cached worktree and opens a
+// terminal running a review tool there, with a prompt describing the PR
+// written next to the checkout. The terminal, the tool and the prompt are
+// all configurable under review: in the config.
+
+type ReviewConfig struct {
+	// Terminal names a preset from terminalPresets; TerminalCommand is a
+	// custom argv used instead. Either way {script} is replaced with the
+	// path of the script to run.
+	Terminal        string   `yaml:"terminal"`
+	TerminalCommand []string `yaml:"terminal_command"`
+	// Tool is the argv run in the checkout. {prompt} is replaced with the
+	// rendered prompt and {prompt_file} with its path.
+	Tool       []string `yaml:"tool"`
+	PromptFile string   `yaml:"prompt_file"`
+
+	// Checkouts are cached; see review_cache.go
+	CacheMaxSize string        `yaml:"cache_max_size"`
+	CacheMaxAge  time.Duration `yaml:"cache_max_age"`
+}
+
+// terminalPresets open a new terminal window (or tmux window) running bash
+// on the review script.
+var terminalPresets = map[string][]string{
+	"terminal": {"osascript",
+		"-e", "on run argv",
+		"-e", `tell app "Terminal" to do script "exec bash " & quoted form of item 1 of argv`,
+		"-e", `tell app "Terminal" to activate`,
+		"-e", "end run",
+		"{script}"},
+	"gnome-terminal": {"gnome-terminal", "--", "bash", "{script}"},
+	"kitty":          {"kitty", "bash", "{script}"},
+	"alacritty":      {"alacritty", "-e", "bash", "{script}"},
+	"wezterm":        {"wezterm", "start", "--", "bash", "{script}"},
+	"tmux":           {"tmux", "new-window", "-n", "review", "bash", "{script}"},
+}
+
+// linuxTerminals are tried in order when no terminal is configured.
+var linuxTerminals = []string{"gnome-terminal", "kitty", "alacritty", "wezterm"}
+
+var defaultReviewTool = []string{"claude", "{prompt}"}
+
+// defaultReviewPrompt is used unless review.prompt_file is set. Prompt files
+// use the same text/template fields as this one.
+const defaultReviewPrompt = `You are reviewing a pull request. Here is the context:
+
+Repository: {{.Repo}}
+PR #{{.Number}}: {{.Title}}
+Author: @{{.Author}}
+Status: {{.Status}}
+
+PR Description:
+{{.Body}}
+
+This PR contains {{len .Commits}} commits:
+{{range .Commits}}{{.SHA}} {{.Subject}}
+{{end}}
+{{len .Files}} files changed, +{{.Additions}} -{{.Deletions}}:
+{{range .Files}} {{.Filename}} | +{{.Additions}} -{{.Deletions}}
+{{end}}
+You are in a local checkout of this PR. The full source code is available to you.
+
+Please review this PR by:
+1. Reading the changed files to understand the full context of each change
+2. Checking for correctness, bugs, edge cases, and error handling
+3. Evaluating code style and consistency with the surrounding codebase
+4. Looking for security issues (injection, auth, data leaks, etc.)
+5. Noting any performance concerns
+
+Assume CI tests have already passed. Do NOT run tests locally.
+
+You have access to:
+- The full repository source (use Read/Grep/Glob to explore)
+- git history: the PR is checked out at HEAD and its base branch is ` + "`{{.BaseRef}}`" + `
+- The PR on GitHub: {{.URL}}
+
+Provide a structured review with:
+- A summary of what the PR does
+- Issues found (critical, suggestions, nits) with file:line references
+- Questions for the author
+- Overall assessment
+`
+
+// reviewContext is the data available to the prompt template.
+type reviewContext struct {
+	Repo    string
+	Number  int
+	Title   string
+	Author  string
+	Status  string
+	URL     string
+	Body    string
+	BaseRef string
+	HeadRef string
+	// Additions and Deletions total the diff
+	Additions int
+	Deletions int
+	// CloneURL is where the base repo is fetched from
+	CloneURL string
+	Commits  []reviewCommit
+	Files    []reviewFile
+}
+
+type reviewCommit struct {
+	SHA     string // abbreviated
+	Subject string
+}
+
+type reviewFile struct {
+	Filename  string
+	Status    string
+	Additions int
+	Deletions int
+}
+
+// validateReviewConfig checks the review section at config load so mistakes
+// show up at startup rather than on the first click.
+func validateReviewConfig() error {
+	r := &config.Review
+	r.PromptFile = expandHome(r.PromptFile)
+	if r.Terminal != "" && len(r.TerminalCommand) > 0 {
+		return fmt.Errorf("review: set terminal or terminal_command, not both")
+	}
+	if r.Terminal != "" && terminalPresets[r.Terminal] == nil {
+		return fmt.Errorf("review.terminal: unknown terminal %q, expected one of %s", r.Terminal, strings.Join(sortedKeys(terminalPresets), ", "))
+	}
+	if len(r.TerminalCommand) > 0 && !containsPlaceholder(r.TerminalCommand, "{script}") {
+		return fmt.Errorf("review.terminal_command must include {script}")
+	}
+	if r.CacheMaxSize != "" {
+		if _, err := parseByteSize(r.CacheMaxSize); err != nil {
+			return fmt.Errorf("review.cache_max_size: %w", err)
+		}
+	}
+	if r.PromptFile != "" {
+		if _, err := loadReviewPrompt(); err != nil {
+			return fmt.Errorf("review.prompt_file: %w", err)
+		}
+	}
+	return nil
+}
+
+func loadReviewPrompt() (*template.Template, error) {
+	text := defaultReviewPrompt
+	if config.Review.PromptFile != "" {
+		data, err := os.ReadFile(config.Review.PromptFile)
+		if err != nil {
+			return nil, err
+		}
+		text = string(data)
+	}
+	return template.New("prompt").Parse(text)
+}
+
+// terminalCommand returns the argv template for opening a terminal.
+func terminalCommand() ([]string, error) {
+	if len(config.Review.TerminalCommand) > 0 {
+		return config.Review.TerminalCommand, nil
+	}
+	if config.Review.Terminal != "" {
+		return terminalPresets[config.Review.Terminal], nil
+	}
+	switch runtime.GOOS {
+	case "darwin":
+		return terminalPresets["terminal"], nil
+	case "linux":
+		for _, name := range linuxTerminals {
+			if _, err := exec.LookPath(name); err == nil {
+				return terminalPresets[name], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no terminal found; set review.terminal or review.terminal_command")
+}
+
+func reviewTool() []string {
+	if len(config.Review.Tool) > 0 {
+		return config.Review.Tool
+	}
+	return defaultReviewTool
+}
+
+// reviewExecutable locates pr-monitor, for git to run as a credential helper.
+var reviewExecutable = os.Executable
+
+// reviewScript is the same for every review. Everything PR-specific is read
+// from review.args next to it, NUL-separated: the repo, PR number, clone URL,
+// mirror and worktree paths, base branch, git credential helper and then the
+// tool's argv. Nothing from GitHub is ever spliced into shell code.
+const reviewScript = `#!/bin/bash
+set -e
+
+DIR=$(cd "$(dirname "$0")" && pwd)
+ARGS=()
+while IFS= read -r -d '' arg; do
+	ARGS+=("$arg")
+done < "$DIR/review.args"
+REPO=${ARGS[0]}
+PR_NUM=${ARGS[1]}
+URL=${ARGS[2]}
+MIRROR=${ARGS[3]}
+WORKTREE=${ARGS[4]}
+BASE_REF=${ARGS[5]}
+HELPER=${ARGS[6]}
+TOOL=("${ARGS[@]:7}")
+
+# Only the git commands here get github.com credentials from pr-monitor; the
+# token isn't handed on to the review session
+authgit() {
+	git -c credential.https://github.com.helper= \
+		-c "credential.https://github.com.helper=$HELPER" \
+		-c credential.https://github.com.useHttpPath=true "$@"
+}
+
+if [ ! -d "$MIRROR" ]; then
+	echo "==> Cloning $REPO (first review of this repo, blobless)..."
+	rm -rf "$MIRROR.tmp"
+	authgit clone --bare --filter=blob:none "$URL" "$MIRROR.tmp"
+	mv "$MIRROR.tmp" "$MIRROR"
+fi
+
+echo "==> Fetching PR #$PR_NUM..."
+authgit -C "$MIRROR" fetch origin "+refs/pull/$PR_NUM/head:refs/pull/$PR_NUM/head" "+refs/heads/$BASE_REF:refs/heads/$BASE_REF"
+
+if [ -d "$WORKTREE" ]; then
+	echo "==> Updating checkout..."
+	authgit -C "$WORKTREE" checkout --detach "refs/pull/$PR_NUM/head"
+else
+	echo "==> Checking out PR #$PR_NUM..."
+	git -C "$MIRROR" worktree prune
+	authgit -C "$MIRROR" worktree add --detach "$WORKTREE" "refs/pull/$PR_NUM/head"
+fi
+cd "$WORKTREE"
+
+# The clone is blobless: fetch what the PR's diff needs now, while git still
+# has credentials
+authgit diff "refs/heads/$BASE_REF...HEAD" > /dev/null
+
+echo "==> Launching ${TOOL[0]}..."
+echo ""
+exec "${TOOL[@]}"
+`
+
+func reviewPR(pr PRInfo) {
+	ctx, cancel := context.WithTimeout(appCtx, time.Minute)
+	defer cancel()
+
+	termArgs, err := terminalCommand()
+	if err != nil {
+		uiLog().Error("Can't start review", prAttr(pr.Repo, pr.Number), "err", err)
+		return
+	}
+
+	scriptPath, err := prepareReview(ctx, reviewCacheDir(), pr)
+	if err != nil {
+		uiLog().Error("Failed to prepare review", prAttr(pr.Repo, pr.Number), "err", err)
+		return
+	}
+
+	openTerminal(termArgs, scriptPath)
+
+	goBackground(func() {
+		if err := gcReviewCache(reviewCacheDir(), reviewCacheMaxSize(), reviewCacheMaxAge(), clock.Now()); err != nil {
+			uiLog().Warn("Failed to clean up review cache", "err", err)
+		}
+	})
+}
+
+// prepareReview writes the prompt, review.args and the script into the PR's
+// session dir under root and returns the script's path. The script does the
+// clone and checkout itself so its progress shows in the terminal.
+func prepareReview(ctx context.Context, root string, pr PRInfo) (string, error) {
+	tmpl, err := loadReviewPrompt()
+	if err != nil {
+		return "", fmt.Errorf("loading prompt: %w", err)
+	}
+
+	rc, err := gatherReviewContext(ctx, pr)
+	if err != nil {
+		return "", fmt.Errorf("gathering PR context: %w", err)
+	}
+
+	paths := reviewPathsFor(root, pr.Repo, pr.Number)
+	for _, dir := range []string{paths.Session, filepath.Dir(paths.Mirror), filepath.Dir(paths.Worktree)} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return "", err
+		}
+	}
+	touch(clock.Now(), paths.Mirror, paths.Worktree)
+
+	var prompt strings.Builder
+	if err := tmpl.Execute(&prompt, rc); err != nil {
+		return "", fmt.Errorf("rendering prompt: %w", err)
+	}
+	promptPath := filepath.Join(paths.Session, "prompt.md")
+	if err := os.WriteFile(promptPath, []byte(prompt.String()), 0600); err != nil {
+		return "", fmt.Errorf("writing prompt: %w", err)
+	}
+
+	tool := expandPlaceholders(reviewTool(), map[string]string{
+		"{prompt}":      prompt.String(),
+		"{prompt_file}": promptPath,
+	})
+	exe, err := reviewExecutable()
+	if err != nil {
+		return "", fmt.Errorf("locating pr-monitor for git credentials: %w", err)
+	}
+	args := append([]string{pr.Repo, strconv.Itoa(pr.Number), rc.CloneURL, paths.Mirror, paths.Worktree, rc.BaseRef, gitCredentialHelper(exe)}, tool...)
+	for _, a := range args {
+		// bash can't carry a NUL in a variable, and it would split the argument
+		if strings.ContainsRune(a, 0) {
+			return "", fmt.Errorf("review arguments can't contain NUL bytes")
+		}
+	}
+	if err := os.WriteFile(filepath.Join(paths.Session, "review.args"), []byte(strings.Join(args, "\x00")+"\x00"), 0600); err != nil {
+		return "", fmt.Errorf("writing review.args: %w", err)
+	}
+
+	scriptPath := filepath.Join(paths.Session, "review.sh")
+	if err := os.WriteFile(scriptPath, []byte(reviewScript), 0700); err != nil {
+		return "", fmt.Errorf("writing script: %w", err)
+	}
+	return scriptPath, nil
+}
+
+// gatherReviewContext fetches what the prompt template needs about pr.
+func gatherReviewContext(ctx context.Context, pr PRInfo) (reviewContext, error) {
+	owner, repo := parseRepo(pr.Repo)
+	client := getClientForOrg(owner)
+	if client == nil {
+		return reviewContext{}, fmt.Errorf("no client available for %s", pr.Repo)
+	}
+
+	ghPR, _, err := client.PullRequests.Get(ctx, owner, repo, pr.Number)
+	if err != nil {
+		return reviewContext{}, fmt.Errorf("fetching PR: %w", err)
+	}
+	commits, err := listAllCommits(ctx, client, owner, repo, pr.Number)
+	if err != nil {
+		return reviewContext{}, fmt.Errorf("fetching commits: %w", err)
+	}
+	files, err := listAllFiles(ctx, client, owner, repo, pr.Number)
+	if err != nil {
+		return reviewContext{}, fmt.Errorf("fetching changed files: %w", err)
+	}
+
+	rc := reviewContext{
+		Repo:    pr.Repo,
+		Number:  pr.Number,
+		Title:   ghPR.GetTitle(),
+		Author:  ghPR.GetUser().GetLogin(),
+		Status:  prStatus(pr),
+		URL:     ghPR.GetHTMLURL(),
+		Body:    ghPR.GetBody(),
+		BaseRef: ghPR.GetBase().GetRef(),
+		HeadRef: ghPR.GetHead().GetRef(),
+
+		Additions: ghPR.GetAdditions(),
+		Deletions: ghPR.GetDeletions(),
+
+		CloneURL: ghPR.GetBase().GetRepo().GetCloneURL(),
+	}
+	if rc.CloneURL == "" {
+		rc.CloneURL = "https://github.com/" + pr.Repo + ".git"
+	}
+	for _, c := range commits {
+		subject, _, _ := strings.Cut(c.GetCommit().GetMessage(), "\n")
+		sha := c.GetSHA()
+		if len(sha) > 7 {
+			sha = sha[:7]
+		}
+		rc.Commits = append(rc.Commits, reviewCommit{SHA: sha, Subject: subject})
+	}
+	for _, f := range files {
+		rc.Files = append(rc.Files, reviewFile{
+			Filename:  f.GetFilename(),
+			Status:    f.GetStatus(),
+			Additions: f.GetAdditions(),
+			Deletions: f.GetDeletions(),
+		})
+	}
+	return rc, nil
+}
+
+// listAllFiles pages through the files a PR changes. GitHub caps this
+// endpoint at 3000 files.
+func listAllFiles(ctx context.Context, client *github.Client, owner, repo string, number int) ([]*github.CommitFile, error) {
+	opts := &github.ListOptions{PerPage: 100}
+	var all []*github.CommitFile
+	for {
+		page, resp, err := client.PullRequests.ListFiles(ctx, owner, repo, number, opts)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, page...)
+		if resp.NextPage == 0 {
+			return all, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func openTerminal(argvTemplate []string, scriptPath string) {
+	argv := expandPlaceholders(argvTemplate, map[string]string{"{script}": scriptPath})
+	cmd := exec.Command(argv[0], argv[1:]...)
+	if err := cmd.Start(); err != nil {
+		uiLog().Error("Failed to open terminal", "command", argv[0], "err", err)
+		return
+	}
+	go cmd.Wait()
+}
+
+// expandPlaceholders substitutes values into each argument of an argv
+// template.
+func expandPlaceholders(argv []string, values map[string]string) []string {
+	pairs := make([]string, 0, 2*len(values))
+	for k, v := range values {
+		pairs = append(pairs, k, v)
+	}
+	r := strings.NewReplacer(pairs...)
+
+	out := make([]string, len(argv))
+	for i, arg := range argv {
+		out[i] = r.Replace(arg)
+	}
+	return out
+}
+
+func containsPlaceholder(argv []string, placeholder string) bool {
+	for _, arg := range argv {
+		if strings.Contains(arg, placeholder) {
+			return true
+		}
+	}
+	return false
+}
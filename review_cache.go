@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Local reviews share one blobless bare clone per repo and check each PR out
+// into its own git worktree, so reviewing another PR in a big repo only
+// fetches what changed. Everything lives under configDir/reviews:
+//
+//	mirrors/<owner>/<repo>.git     bare clone
+//	worktrees/<owner>/<repo>/<N>   checkout of refs/pull/<N>/head
+//	sessions/<owner>/<repo>/<N>    review.sh, review.args and prompt.md
+//
+// Directory mtimes record when each was last used. gcReviewCache drops
+// worktrees and mirrors unused for longer than review.cache_max_age, then the
+// least recently used ones until the cache fits in review.cache_max_size.
+
+const (
+	defaultReviewCacheMaxSize = 20 << 30
+	defaultReviewCacheMaxAge  = 14 * 24 * time.Hour
+
+	// reviewCacheGrace protects checkouts that were just prepared (and are
+	// probably still being cloned or reviewed) from size-based eviction.
+	reviewCacheGrace = time.Hour
+)
+
+// reviewPaths locates a PR's mirror, worktree and session files.
+type reviewPaths struct {
+	Mirror   string
+	Worktree string
+	Session  string
+}
+
+func reviewCacheDir() string {
+	return filepath.Join(configDir, "reviews")
+}
+
+func reviewPathsFor(root, repo string, number int) reviewPaths {
+	owner, name := parseRepo(repo)
+	owner, name = cachePathElem(owner), cachePathElem(name)
+	n := strconv.Itoa(number)
+	return reviewPaths{
+		Mirror:   filepath.Join(root, "mirrors", owner, name+".git"),
+		Worktree: filepath.Join(root, "worktrees", owner, name, n),
+		Session:  filepath.Join(root, "sessions", owner, name, n),
+	}
+}
+
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// cachePathElem keeps a repo or owner name to a single, harmless path element.
+func cachePathElem(s string) string {
+	s = unsafePathChars.ReplaceAllString(s, "_")
+	if s == "" || s == "." || s == ".." {
+		return "_"
+	}
+	return s
+}
+
+// touch marks each existing path as used now.
+func touch(now time.Time, paths ...string) {
+	for _, p := range paths {
+		os.Chtimes(p, now, now)
+	}
+}
+
+func reviewCacheMaxSize() int64 {
+	if config.Review.CacheMaxSize == "" {
+		return defaultReviewCacheMaxSize
+	}
+	n, _ := parseByteSize(config.Review.CacheMaxSize)
+	return n
+}
+
+func reviewCacheMaxAge() time.Duration {
+	if config.Review.CacheMaxAge > 0 {
+		return config.Review.CacheMaxAge
+	}
+	return defaultReviewCacheMaxAge
+}
+
+var byteSizePattern = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*([KMGT]?)B?$`)
+
+// parseByteSize parses sizes like 500MB or 20GB (powers of 1024).
+func parseByteSize(s string) (int64, error) {
+	m := byteSizePattern.FindStringSubmatch(strings.ToUpper(strings.TrimSpace(s)))
+	if m == nil {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 500MB or 20GB", s)
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	shift := strings.Index("KMGT", m[2]) + 1
+	if m[2] == "" {
+		shift = 0
+	}
+	return int64(n * float64(int64(1)<<(10*shift))), nil
+}
+
+// cacheEntry is a mirror or worktree considered for eviction.
+type cacheEntry struct {
+	path     string
+	mirror   string // the mirror a worktree belongs to; its own path for mirrors
+	session  string // session dir removed along with a worktree
+	lastUsed time.Time
+	size     int64
+}
+
+// gcReviewCache evicts unused checkouts and mirrors under root. Removing a
+// mirror also removes its worktrees, which can't work without it.
+func gcReviewCache(root string, maxSize int64, maxAge time.Duration, now time.Time) error {
+	mirrors, err := scanCacheEntries(root, filepath.Join(root, "mirrors", "*", "*.git"))
+	if err != nil {
+		return err
+	}
+	worktrees, err := scanCacheEntries(root, filepath.Join(root, "worktrees", "*", "*", "*"))
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, e := range slices.Concat(mirrors, worktrees) {
+		total += e.size
+	}
+
+	removed := make(map[string]bool)
+	remove := func(e cacheEntry) {
+		if removed[e.path] {
+			return
+		}
+		removed[e.path] = true
+		if err := os.RemoveAll(e.path); err != nil {
+			uiLog().Warn("Failed to remove cached checkout", "path", e.path, "err", err)
+			return
+		}
+		if e.session != "" {
+			os.RemoveAll(e.session)
+		}
+		total -= e.size
+	}
+	removeMirror := func(m cacheEntry) {
+		for _, w := range worktrees {
+			if w.mirror == m.path {
+				remove(w)
+			}
+		}
+		remove(m)
+	}
+
+	// Anything unused for too long goes, worktrees first so a mirror whose
+	// worktrees have all expired can go too
+	for _, w := range worktrees {
+		if now.Sub(w.lastUsed) > maxAge {
+			remove(w)
+		}
+	}
+	for _, m := range mirrors {
+		if now.Sub(m.lastUsed) > maxAge && !hasWorktrees(worktrees, removed, m.path) {
+			remove(m)
+		}
+	}
+
+	// Then least recently used first until the cache fits
+	candidates := slices.Concat(mirrors, worktrees)
+	slices.SortFunc(candidates, func(a, b cacheEntry) int { return a.lastUsed.Compare(b.lastUsed) })
+	for _, e := range candidates {
+		if total <= maxSize {
+			break
+		}
+		if removed[e.path] || now.Sub(e.lastUsed) < reviewCacheGrace {
+			continue
+		}
+		if e.mirror == e.path {
+			removeMirror(e)
+		} else {
+			remove(e)
+		}
+	}
+
+	// Let each surviving mirror forget its removed worktrees
+	for _, m := range mirrors {
+		if !removed[m.path] {
+			exec.Command("git", "-C", m.path, "worktree", "prune").Run()
+		}
+	}
+	return nil
+}
+
+func hasWorktrees(worktrees []cacheEntry, removed map[string]bool, mirror string) bool {
+	for _, w := range worktrees {
+		if w.mirror == mirror && !removed[w.path] {
+			return true
+		}
+	}
+	return false
+}
+
+func scanCacheEntries(root, pattern string) ([]cacheEntry, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []cacheEntry
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		e := cacheEntry{path: p, mirror: p, lastUsed: info.ModTime(), size: dirSize(p)}
+
+		// worktrees/<owner>/<repo>/<N> belongs to mirrors/<owner>/<repo>.git
+		if rel, err := filepath.Rel(filepath.Join(root, "worktrees"), p); err == nil && !strings.HasPrefix(rel, "..") {
+			parts := strings.Split(rel, string(filepath.Separator))
+			e.mirror = filepath.Join(root, "mirrors", parts[0], parts[1]+".git")
+			e.session = filepath.Join(root, "sessions", rel)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func dirSize(path string) int64 {
+	var size int64
+	filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && d.Type().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// cacheFixture lays out a mirror or worktree of the given size, last used at.
+func cacheFixture(t *testing.T, dir string, size int, at time.Time) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "data"), make([]byte, size), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(dir, at, at)
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func TestGCReviewCacheDropsExpiredCheckouts(t *testing.T) {
+	root := t.TempDir()
+	old := reviewPathsFor(root, "acme/api", 1)
+	recent := reviewPathsFor(root, "acme/api", 2)
+	lonely := reviewPathsFor(root, "acme/web", 3)
+
+	cacheFixture(t, old.Mirror, 10, testNow.Add(-30*24*time.Hour))
+	cacheFixture(t, old.Worktree, 10, testNow.Add(-30*24*time.Hour))
+	cacheFixture(t, old.Session, 1, testNow)
+	cacheFixture(t, recent.Worktree, 10, testNow.Add(-time.Hour))
+	cacheFixture(t, lonely.Mirror, 10, testNow.Add(-30*24*time.Hour))
+	cacheFixture(t, lonely.Worktree, 10, testNow.Add(-30*24*time.Hour))
+
+	if err := gcReviewCache(root, 1<<30, 14*24*time.Hour, testNow); err != nil {
+		t.Fatal(err)
+	}
+
+	if exists(old.Worktree) || exists(old.Session) {
+		t.Error("expired worktree and its session should be removed")
+	}
+	if !exists(recent.Worktree) || !exists(old.Mirror) {
+		t.Error("a mirror with a recently used worktree should be kept")
+	}
+	if exists(lonely.Mirror) || exists(lonely.Worktree) {
+		t.Error("an expired mirror with only expired worktrees should be removed")
+	}
+}
+
+func TestGCReviewCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	root := t.TempDir()
+	api := reviewPathsFor(root, "acme/api", 1)
+	api2 := reviewPathsFor(root, "acme/api", 2)
+	web := reviewPathsFor(root, "acme/web", 3)
+	current := reviewPathsFor(root, "acme/ui", 4)
+
+	cacheFixture(t, api.Mirror, 100, testNow.Add(-5*time.Hour))
+	cacheFixture(t, api.Worktree, 100, testNow.Add(-5*time.Hour))
+	cacheFixture(t, api2.Worktree, 100, testNow.Add(-4*time.Hour))
+	cacheFixture(t, web.Mirror, 100, testNow.Add(-2*time.Hour))
+	cacheFixture(t, web.Worktree, 100, testNow.Add(-3*time.Hour))
+	cacheFixture(t, current.Mirror, 1000, testNow)
+
+	// 1500 bytes cached; evicting the api mirror takes both its worktrees
+	if err := gcReviewCache(root, 1200, 14*24*time.Hour, testNow); err != nil {
+		t.Fatal(err)
+	}
+
+	if exists(api.Mirror) || exists(api.Worktree) || exists(api2.Worktree) {
+		t.Error("the least recently used mirror and its worktrees should be evicted")
+	}
+	if !exists(web.Mirror) || !exists(web.Worktree) {
+		t.Error("eviction should stop once the cache fits")
+	}
+	if !exists(current.Mirror) {
+		t.Error("a checkout used within the grace period should never be evicted")
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	for s, want := range map[string]int64{
+		"1024":  1024,
+		"500MB": 500 << 20,
+		"20GB":  20 << 30,
+		"1.5g":  3 << 29,
+		"2 TB":  2 << 40,
+	} {
+		if got, err := parseByteSize(s); err != nil || got != want {
+			t.Errorf("parseByteSize(%q) = %d, %v; want %d", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "lots", "5PB", "-1GB"} {
+		if _, err := parseByteSize(s); err == nil {
+			t.Errorf("parseByteSize(%q) should fail", s)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// Reviews can be submitted without leaving the monitor: `pr-monitor review`
+// takes any verdict, and the tray's "Quick Approve" item approves after a
+// confirmation. Either way the PR is rechecked straight away, so it leaves the
+// queue without waiting for the next poll.
+
+// reviewEvents maps the verdicts accepted on the command line to the events
+// of the create review API.
+var reviewEvents = map[string]string{
+	"approve":         "APPROVE",
+	"request-changes": "REQUEST_CHANGES",
+	"comment":         "COMMENT",
+}
+
+// submitReview submits a review with the given event (APPROVE,
+// REQUEST_CHANGES or COMMENT) and rechecks the PR. Only approvals may have an
+// empty body, as on GitHub.
+func submitReview(ctx context.Context, repo string, number int, event, body string) error {
+	if event != "APPROVE" && strings.TrimSpace(body) == "" {
+		return fmt.Errorf("a message is required to %s", strings.ReplaceAll(strings.ToLower(event), "_", " "))
+	}
+
+	owner, repoName := parseRepo(repo)
+	client := getClientForOrg(owner)
+	if client == nil {
+		return fmt.Errorf("no client available for %s", repo)
+	}
+
+	review := &github.PullRequestReviewRequest{Event: github.String(event)}
+	if body != "" {
+		review.Body = github.String(body)
+	}
+	if _, _, err := client.PullRequests.CreateReview(ctx, owner, repoName, number, review); err != nil {
+		return fmt.Errorf("submitting review: %w", err)
+	}
+	uiLog().Info("Submitted review", prAttr(repo, number), "event", event)
+
+	authorSet := make(map[string]bool)
+	for _, a := range config.Authors {
+		authorSet[a] = true
+	}
+	recheckPR(ctx, client, owner, repoName, repo, number, authorSet)
+	return nil
+}
+
+// quickApprove approves pr from the tray menu.
+func quickApprove(pr PRInfo) {
+	ctx, cancel := context.WithTimeout(appCtx, 30*time.Second)
+	defer cancel()
+
+	if err := submitReview(ctx, pr.Repo, pr.Number, "APPROVE", ""); err != nil {
+		uiLog().Error("Quick approve failed", prAttr(pr.Repo, pr.Number), "err", err)
+	}
+}
+
+func runReview(args []string) error {
+	fs := flag.NewFlagSet("review", flag.ContinueOnError)
+	message := fs.String("m", "", "review comment; required unless approving")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("usage: pr-monitor review [-m message] approve|request-changes|comment owner/repo#123")
+	}
+	event, ok := reviewEvents[fs.Arg(0)]
+	if !ok {
+		return fmt.Errorf("invalid verdict %q: expected approve, request-changes or comment", fs.Arg(0))
+	}
+	repo, number, err := parsePRRef(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	if err := openClientsForCommand(); err != nil {
+		return err
+	}
+	defer store.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := submitReview(ctx, repo, number, event, *message); err != nil {
+		return err
+	}
+	fmt.Printf("Submitted %s review on %s#%d\n", fs.Arg(0), repo, number)
+	return nil
+}
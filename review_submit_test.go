@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSubmitReviewTakesPROffTheQueue(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.addPR(7, "alice", requested("me"))
+	store.SavePR(PRInfo{Repo: "acme/api", Number: 7, Author: "alice", NeedsReview: true, Reason: reasonDirect})
+
+	if err := submitReview(t.Context(), "acme/api", 7, "APPROVE", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := gh.reviews["acme/api#7"]; len(got) != 1 || got[0].GetState() != "APPROVED" {
+		t.Fatalf("reviews = %v, want one approval", got)
+	}
+	if active, _ := store.LoadActivePRs(); len(active) != 0 {
+		t.Errorf("active PRs = %v, want the approved PR gone without waiting for a poll", active)
+	}
+}
+
+func TestSubmitReviewRequiresMessage(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.addPR(7, "alice", requested("me"))
+
+	err := submitReview(t.Context(), "acme/api", 7, "REQUEST_CHANGES", "  ")
+	if err == nil || !strings.Contains(err.Error(), "message is required") {
+		t.Fatalf("err = %v, want a missing message error", err)
+	}
+	if n := gh.requestCount("POST", "/repos/acme/api/pulls/7/reviews"); n != 0 {
+		t.Errorf("review submitted %d times without a message", n)
+	}
+
+	if err := submitReview(t.Context(), "acme/api", 7, "REQUEST_CHANGES", "Please add a test."); err != nil {
+		t.Fatal(err)
+	}
+	if got := gh.reviews["acme/api#7"]; len(got) != 1 || got[0].GetBody() != "Please add a test." {
+		t.Errorf("reviews = %v, want the change request with its message", got)
+	}
+}
@@ -0,0 +1,381 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v57/github"
+)
+
+func TestGatherReviewContextRendersDefaultPrompt(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.addPR(7, "alice", func(pr *github.PullRequest) {
+		pr.Title = github.String("Add retries")
+		pr.Body = github.String("Retries failed uploads.")
+		pr.Base = &github.PullRequestBranch{Ref: github.String("main")}
+		pr.Head = &github.PullRequestBranch{Ref: github.String("retries")}
+	})
+	gh.commits["acme/api#7"] = []*github.RepositoryCommit{
+		{SHA: github.String("0123456789abcdef"), Commit: &github.Commit{Message: github.String("Retry uploads\n\nWith backoff.")}},
+	}
+	gh.files["acme/api#7"] = []*github.CommitFile{
+		{Filename: github.String("upload.go"), Status: github.String("modified"), Additions: github.Int(12), Deletions: github.Int(3)},
+	}
+
+	rc, err := gatherReviewContext(t.Context(), PRInfo{Repo: "acme/api", Number: 7, NeedsReview: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rc.BaseRef != "main" || rc.HeadRef != "retries" || rc.Author != "alice" {
+		t.Errorf("context = %+v, want main...retries by alice", rc)
+	}
+
+	tmpl, err := loadReviewPrompt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prompt strings.Builder
+	if err := tmpl.Execute(&prompt, rc); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"PR #7: Add retries",
+		"Retries failed uploads.",
+		"This PR contains 1 commits:\n0123456 Retry uploads\n",
+		" upload.go | +12 -3\n",
+		"Status: needs review",
+	} {
+		if !strings.Contains(prompt.String(), want) {
+			t.Errorf("prompt missing %q:\n%s", want, prompt.String())
+		}
+	}
+}
+
+func TestReviewPromptFromFile(t *testing.T) {
+	setupTest(t)
+	path := filepath.Join(t.TempDir(), "prompt.md")
+	if err := os.WriteFile(path, []byte("Review {{.Repo}}#{{.Number}}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	config.Review.PromptFile = path
+	if err := validateReviewConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl, err := loadReviewPrompt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prompt strings.Builder
+	tmpl.Execute(&prompt, reviewContext{Repo: "acme/api", Number: 3})
+	if prompt.String() != "Review acme/api#3" {
+		t.Errorf("prompt = %q", prompt.String())
+	}
+
+	os.WriteFile(path, []byte("{{.Repo"), 0600)
+	if err := validateReviewConfig(); err == nil {
+		t.Error("expected a broken template to be rejected")
+	}
+}
+
+func TestValidateReviewConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		review ReviewConfig
+		ok     bool
+	}{
+		{"defaults", ReviewConfig{}, true},
+		{"preset", ReviewConfig{Terminal: "kitty"}, true},
+		{"unknown preset", ReviewConfig{Terminal: "xterm"}, false},
+		{"custom", ReviewConfig{TerminalCommand: []string{"foot", "bash", "{script}"}}, true},
+		{"custom without script", ReviewConfig{TerminalCommand: []string{"foot"}}, false},
+		{"both", ReviewConfig{Terminal: "kitty", TerminalCommand: []string{"foot", "{script}"}}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setupTest(t)
+			config.Review = tc.review
+			if err := validateReviewConfig(); (err == nil) != tc.ok {
+				t.Errorf("validateReviewConfig() = %v, want ok=%v", err, tc.ok)
+			}
+		})
+	}
+}
+
+func TestExpandPlaceholders(t *testing.T) {
+	got := expandPlaceholders(
+		[]string{"tool", "--prompt-file={prompt_file}", "{prompt}"},
+		map[string]string{"{prompt}": "review {prompt_file} please", "{prompt_file}": "/tmp/p.md"},
+	)
+	// Substituted values aren't expanded again
+	want := []string{"tool", "--prompt-file=/tmp/p.md", "review {prompt_file} please"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expandPlaceholders = %q, want %q", got, want)
+	}
+}
+
+// TestReviewScriptIgnoresShellInPRData runs the generated script against a
+// local origin and a stub tool, with PR data that would execute commands if
+// it were ever interpolated into shell.
+func TestReviewScriptIgnoresShellInPRData(t *testing.T) {
+	gh, _ := setupTest(t)
+	origin := newGitOrigin(t, 7)
+	canary := filepath.Join(t.TempDir(), "pwned")
+	payload := fmt.Sprintf("$(touch %[1]s) `touch %[1]s` '; touch %[1]s; ' \"; touch %[1]s; \"\nPROMPT_EOF\n$HOME ${PATH}", canary)
+	gh.addPR(7, "alice", func(pr *github.PullRequest) {
+		pr.Title = github.String(payload)
+		pr.Body = github.String(payload)
+		pr.Base = &github.PullRequestBranch{Ref: github.String("main"), Repo: &github.Repository{CloneURL: github.String("file://" + origin)}}
+	})
+	gh.commits["acme/api#7"] = []*github.RepositoryCommit{
+		{SHA: github.String("0123456789"), Commit: &github.Commit{Message: github.String(payload)}},
+	}
+	gh.files["acme/api#7"] = []*github.CommitFile{{Filename: github.String(payload)}}
+
+	bin := t.TempDir()
+	argsOut := filepath.Join(t.TempDir(), "args")
+	tool := filepath.Join(bin, "review-tool")
+	writeStub(t, tool, `pwd > "$ARGS_OUT.pwd"; printf '%s\0' "$@" > "$ARGS_OUT"`)
+	config.Review.Tool = []string{tool, "{prompt}", "--file={prompt_file}", payload}
+
+	root := t.TempDir()
+	scriptPath, err := prepareReview(t.Context(), root, PRInfo{Repo: "acme/api", Number: 7, Title: payload, Author: payload})
+	if err != nil {
+		t.Fatal(err)
+	}
+	runReviewScript(t, scriptPath, "ARGS_OUT="+argsOut)
+
+	if _, err := os.Stat(canary); !os.IsNotExist(err) {
+		t.Fatal("PR data was executed by the shell")
+	}
+	out, err := os.ReadFile(argsOut)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	promptPath := filepath.Join(filepath.Dir(scriptPath), "prompt.md")
+	prompt, _ := os.ReadFile(promptPath)
+	want := []string{string(prompt), "--file=" + promptPath, payload}
+	if !slices.Equal(got, want) {
+		t.Errorf("tool args = %q, want %q", got, want)
+	}
+	if !strings.Contains(string(prompt), "PR #7: "+payload) {
+		t.Errorf("prompt doesn't carry the title verbatim:\n%s", prompt)
+	}
+
+	worktree := reviewPathsFor(root, "acme/api", 7).Worktree
+	if pwd, _ := os.ReadFile(argsOut + ".pwd"); strings.TrimSpace(string(pwd)) != worktree {
+		t.Errorf("tool ran in %q, want the worktree %q", pwd, worktree)
+	}
+	if data, err := os.ReadFile(filepath.Join(worktree, "change.txt")); err != nil || string(data) != "pr 7\n" {
+		t.Errorf("worktree change.txt = %q, %v; want the PR's version", data, err)
+	}
+}
+
+func TestReviewReusesMirrorAndWorktree(t *testing.T) {
+	gh, _ := setupTest(t)
+	origin := newGitOrigin(t, 7, 8)
+	for _, n := range []int{7, 8} {
+		gh.addPR(n, "alice", func(pr *github.PullRequest) {
+			pr.Base = &github.PullRequestBranch{Ref: github.String("main"), Repo: &github.Repository{CloneURL: github.String("file://" + origin)}}
+		})
+	}
+	config.Review.Tool = []string{"true"}
+	root := t.TempDir()
+
+	review := func(n int) string {
+		t.Helper()
+		scriptPath, err := prepareReview(t.Context(), root, PRInfo{Repo: "acme/api", Number: n})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return runReviewScript(t, scriptPath)
+	}
+
+	if out := review(7); !strings.Contains(out, "Cloning") {
+		t.Errorf("first review didn't clone:\n%s", out)
+	}
+	if out := review(8); strings.Contains(out, "Cloning") {
+		t.Errorf("second PR cloned again instead of reusing the mirror:\n%s", out)
+	}
+
+	// The PR gets a new commit; reviewing it again updates the same worktree
+	gitRun(t, origin, "update-ref", "refs/pull/7/head", gitCommitFile(t, origin, "pr 7 v2\n"))
+	if out := review(7); !strings.Contains(out, "Updating checkout") {
+		t.Errorf("re-review didn't reuse the worktree:\n%s", out)
+	}
+	data, _ := os.ReadFile(filepath.Join(reviewPathsFor(root, "acme/api", 7).Worktree, "change.txt"))
+	if string(data) != "pr 7 v2\n" {
+		t.Errorf("worktree change.txt = %q after update", data)
+	}
+}
+
+func TestReviewGitUsesCredentialHelper(t *testing.T) {
+	gh, _ := setupTest(t)
+	origin := newGitOrigin(t, 7)
+	gh.addPR(7, "alice", func(pr *github.PullRequest) {
+		pr.Base = &github.PullRequestBranch{Ref: github.String("main"), Repo: &github.Repository{CloneURL: github.String("file://" + origin)}}
+	})
+
+	// Stands in for pr-monitor; records what git asked
+	bin := filepath.Join(t.TempDir(), "bin dir")
+	os.Mkdir(bin, 0700)
+	helper := filepath.Join(bin, "pr-monitor")
+	writeStub(t, helper, `cat > "$OUT.asked"; printf 'username=x\npassword=from-pr-monitor\n'`)
+	reviewExecutable = func() (string, error) { return helper, nil }
+	t.Cleanup(func() { reviewExecutable = os.Executable })
+
+	// A helper the user already has, e.g. gh's, must not win
+	home := t.TempDir()
+	os.WriteFile(filepath.Join(home, ".gitconfig"), []byte("[credential]\n\thelper = \"!printf 'username=x\\\\npassword=from-user-config\\\\n'\"\n"), 0600)
+
+	// A file:// origin never asks for credentials, so a wrapper records the
+	// script's git commands and, for the fetch, what credentials git would
+	// have used
+	realGit, _ := exec.LookPath("git")
+	writeStub(t, filepath.Join(bin, "git"), `
+if [ "$9" = fetch ]; then
+	printf 'protocol=https\nhost=github.com\npath=acme/api.git\n\n' | "`+realGit+`" "${@:1:6}" credential fill > "$OUT.fetch"
+fi
+exec "`+realGit+`" "$@"`)
+
+	tool := filepath.Join(bin, "review-tool")
+	writeStub(t, tool, `env > "$OUT.env"; printf 'protocol=https\nhost=github.com\npath=acme/api.git\n\n' | git credential fill > "$OUT.tool"`)
+	config.Review.Tool = []string{tool}
+
+	scriptPath, err := prepareReview(t.Context(), t.TempDir(), PRInfo{Repo: "acme/api", Number: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(t.TempDir(), "cred")
+	runReviewScript(t, scriptPath, "OUT="+out, "HOME="+home, "PATH="+bin+":"+os.Getenv("PATH"))
+
+	if got, _ := os.ReadFile(out + ".fetch"); !strings.Contains(string(got), "password=from-pr-monitor") {
+		t.Errorf("fetch credentials = %q, want pr-monitor's", got)
+	}
+	if asked, _ := os.ReadFile(out + ".asked"); !strings.Contains(string(asked), "path=acme/api.git") {
+		t.Errorf("helper was asked %q, want the repo path included", asked)
+	}
+
+	// The review session is left with the user's own git setup
+	if got, _ := os.ReadFile(out + ".tool"); !strings.Contains(string(got), "password=from-user-config") {
+		t.Errorf("git credential fill in the review session = %q, want the user's own helper", got)
+	}
+	env, _ := os.ReadFile(out + ".env")
+	for line := range strings.Lines(string(env)) {
+		// GIT_CONFIG_NOSYSTEM is gitEnv's
+		if strings.HasPrefix(line, "GIT_CONFIG_") && !strings.HasPrefix(line, "GIT_CONFIG_NOSYSTEM=") {
+			t.Errorf("review tool's environment has %s", strings.TrimSpace(line))
+		}
+	}
+}
+
+func TestGitCredential(t *testing.T) {
+	setupTest(t)
+	config.GitHubToken = "default-token"
+	config.OrgTokens = map[string]string{"acme": "acme-token"}
+
+	for _, tc := range []struct {
+		op, input, want string
+	}{
+		{"get", "protocol=https\nhost=github.com\npath=acme/api.git\n\n", "username=x-access-token\npassword=acme-token\n"},
+		{"get", "protocol=https\nhost=github.com\npath=other/repo.git\n", "username=x-access-token\npassword=default-token\n"},
+		{"get", "protocol=https\nhost=github.com\n\n", ""},
+		{"get", "protocol=https\nhost=gitlab.com\npath=acme/api.git\n\n", ""},
+		{"get", "protocol=http\nhost=github.com\npath=acme/api.git\n\n", ""},
+		{"store", "protocol=https\nhost=github.com\npath=acme/api.git\n\n", ""},
+	} {
+		var out strings.Builder
+		if err := gitCredential(tc.op, strings.NewReader(tc.input), &out); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tc.want {
+			t.Errorf("gitCredential(%s, %q) = %q, want %q", tc.op, tc.input, out.String(), tc.want)
+		}
+	}
+}
+
+func TestPrepareReviewRejectsNUL(t *testing.T) {
+	gh, _ := setupTest(t)
+	gh.addPR(7, "alice")
+	config.Review.Tool = []string{"tool", "a\x00b"}
+
+	if _, err := prepareReview(t.Context(), t.TempDir(), PRInfo{Repo: "acme/api", Number: 7}); err == nil {
+		t.Error("expected an argument with a NUL byte to be rejected")
+	}
+}
+
+func writeStub(t *testing.T, path, body string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte("#!/bin/bash\n"+body+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// gitEnv isolates git from the user's and system config.
+func gitEnv(t *testing.T) []string {
+	return append(os.Environ(),
+		"HOME="+t.TempDir(),
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	)
+}
+
+func gitRun(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = gitEnv(t)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// gitCommitFile commits change.txt on a detached HEAD off main and returns
+// the commit.
+func gitCommitFile(t *testing.T, repo, content string) string {
+	t.Helper()
+	gitRun(t, repo, "checkout", "-q", "--detach", "main")
+	os.WriteFile(filepath.Join(repo, "change.txt"), []byte(content), 0644)
+	gitRun(t, repo, "add", "change.txt")
+	gitRun(t, repo, "commit", "-q", "-m", "change")
+	return gitRun(t, repo, "rev-parse", "HEAD")
+}
+
+// newGitOrigin creates a repo with a main branch and refs/pull/<n>/head for
+// each PR, like GitHub's.
+func newGitOrigin(t *testing.T, prs ...int) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not available")
+	}
+	origin := t.TempDir()
+	gitRun(t, origin, "init", "-q", "-b", "main")
+	os.WriteFile(filepath.Join(origin, "README"), []byte("hello\n"), 0644)
+	gitRun(t, origin, "add", "README")
+	gitRun(t, origin, "commit", "-q", "-m", "initial")
+	for _, n := range prs {
+		gitRun(t, origin, "update-ref", fmt.Sprintf("refs/pull/%d/head", n), gitCommitFile(t, origin, fmt.Sprintf("pr %d\n", n)))
+	}
+	return origin
+}
+
+func runReviewScript(t *testing.T, scriptPath string, env ...string) string {
+	t.Helper()
+	cmd := exec.Command("bash", scriptPath)
+	cmd.Env = append(gitEnv(t), env...)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("script failed: %v\n%s", err, out)
+	}
+	return string(out)
+}
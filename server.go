@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// The webhook receiver, metrics and PR previews are each served on their own
+// configured address. Features configured on the same address share one
+// server.
+
+func startHTTPServers(ctx context.Context) {
+	muxes := make(map[string]*http.ServeMux)
+	handle := func(addr, pattern string, handler http.HandlerFunc) {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+		muxes[addr].HandleFunc(pattern, handler)
+	}
+
+	if webhookEnabled() {
+		handle(config.Webhook.Listen, webhookPath(), handleWebhook)
+		webhookLog().Info("Listening for GitHub webhooks", "addr", config.Webhook.Listen, "path", webhookPath())
+	}
+	if metricsEnabled() {
+		handle(config.Metrics.Listen, metricsPath, handleMetrics)
+		metricsLog().Info("Serving metrics", "addr", config.Metrics.Listen, "path", metricsPath)
+	}
+	if previewEnabled() {
+		handle(config.Preview.Listen, "GET /pr/{owner}/{repo}/{number}", handlePreview)
+		uiLog().Info("Serving PR previews", "addr", config.Preview.Listen)
+	}
+
+	for addr, mux := range muxes {
+		serveHTTP(ctx, addr, mux)
+	}
+}
+
+// serveHTTP runs an HTTP server on addr until ctx is cancelled.
+func serveHTTP(ctx context.Context, addr string, handler http.Handler) {
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("HTTP server error", "addr", addr, "err", err)
+		}
+	}()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+}
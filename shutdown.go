@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/getlantern/systray"
+)
+
+// Background work runs under appCtx, which is cancelled when the app quits
+// from the menu or on SIGINT/SIGTERM. Goroutines that write to the store are
+// started with goBackground so shutdown can wait for them before closing it.
+
+// shutdownTimeout bounds how long Quit waits for in-flight work.
+const shutdownTimeout = 5 * time.Second
+
+var (
+	appCtx, cancelApp = context.WithCancel(context.Background())
+
+	background   sync.WaitGroup
+	backgroundMu sync.Mutex // orders goBackground against shutdown's Wait
+)
+
+// goBackground runs fn in a goroutine tracked by shutdown. Once shutdown has
+// started, fn is not run at all and goBackground returns false.
+func goBackground(fn func()) bool {
+	backgroundMu.Lock()
+	defer backgroundMu.Unlock()
+
+	if appCtx.Err() != nil {
+		return false
+	}
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		fn()
+	}()
+	return true
+}
+
+// handleSignals quits the tray on SIGINT/SIGTERM so onExit runs the same
+// shutdown path as the Quit menu item.
+func handleSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-ch
+		slog.Info("Shutting down", "signal", sig.String())
+		systray.Quit()
+	}()
+}
+
+// shutdown cancels all background work, waits up to shutdownTimeout for it to
+// finish and closes the store.
+func shutdown() {
+	backgroundMu.Lock()
+	cancelApp()
+	backgroundMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		background.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		slog.Warn("Background work still running; closing database anyway", "waited", shutdownTimeout)
+	}
+
+	if store != nil {
+		store.Close()
+	}
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Triage sync shares ignore/mute decisions between machines through a shared
+// directory (Dropbox, NFS, a git checkout...). Each device appends its own
+// actions to <dir>/<device>.jsonl and never writes anyone else's file, so the
+// directory can be synced by tools that don't handle concurrent writes. Every
+// device replays all logs and keeps the latest action per PR and flag.
+
+const defaultSyncInterval = time.Minute
+
+const (
+	triageIgnore   = "ignore"
+	triageUnignore = "unignore"
+	triageMute     = "mute"
+	triageUnmute   = "unmute"
+)
+
+type triageEvent struct {
+	Time   time.Time `json:"time"`
+	Device string    `json:"device"`
+	Action string    `json:"action"`
+	Repo   string    `json:"repo"`
+	Number int       `json:"number"`
+}
+
+// field returns the prs column the action affects and the value it sets.
+func (e triageEvent) field() (column string, value bool, ok bool) {
+	switch e.Action {
+	case triageIgnore:
+		return "ignored", true, true
+	case triageUnignore:
+		return "ignored", false, true
+	case triageMute:
+		return "muted", true, true
+	case triageUnmute:
+		return "muted", false, true
+	}
+	return "", false, false
+}
+
+// newerThan orders events by time, breaking ties on device name so every
+// device picks the same winner.
+func (e triageEvent) newerThan(t time.Time, device string) bool {
+	if !e.Time.Equal(t) {
+		return e.Time.After(t)
+	}
+	return e.Device > device
+}
+
+var syncDevice string
+
+func syncEnabled() bool {
+	return config.Sync.Dir != ""
+}
+
+func initSync() {
+	if !syncEnabled() {
+		return
+	}
+
+	config.Sync.Dir = expandHome(config.Sync.Dir)
+	syncDevice = config.Sync.Device
+	if syncDevice == "" {
+		host, err := os.Hostname()
+		if err != nil {
+			syncLog().Warn("Triage sync disabled, couldn't determine device name", "err", err)
+			config.Sync.Dir = ""
+			return
+		}
+		syncDevice = host
+	}
+	syncDevice = strings.NewReplacer("/", "_", "\\", "_", " ", "_").Replace(syncDevice)
+
+	if err := os.MkdirAll(config.Sync.Dir, 0755); err != nil {
+		syncLog().Warn("Triage sync disabled, couldn't create sync dir", "dir", config.Sync.Dir, "err", err)
+		config.Sync.Dir = ""
+		return
+	}
+
+	if applied, err := syncTriage(); err != nil {
+		syncLog().Error("Triage sync error", "err", err)
+	} else if len(applied) > 0 {
+		syncLog().Info("Applied triage changes from other devices", "count", len(applied))
+	}
+}
+
+// syncLoop periodically pulls triage actions recorded by other devices
+func syncLoop(ctx context.Context) {
+	interval := defaultSyncInterval
+	if config.Sync.Interval > 0 {
+		interval = config.Sync.Interval
+	}
+
+	ticker := clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+		case <-ctx.Done():
+			return
+		}
+
+		applied, err := syncTriage()
+		if err != nil {
+			syncLog().Error("Triage sync error", "err", err)
+			continue
+		}
+		if len(applied) > 0 {
+			syncLog().Info("Applied triage changes from other devices", "count", len(applied))
+			reloadPRsFromDB()
+		}
+		if repos := clearedRepos(applied); len(repos) > 0 {
+			// What's stored for an un-ignored or un-muted PR may be long out of date
+			goBackground(func() { refreshRepos(ctx, repos) })
+		}
+	}
+}
+
+// clearedRepos lists the monitored repos with PRs un-ignored or un-muted by
+// events.
+func clearedRepos(events []triageEvent) []string {
+	monitored := makeRepoSet()
+	var repos []string
+	for _, e := range events {
+		if (e.Action == triageUnignore || e.Action == triageUnmute) && monitored[e.Repo] && !slices.Contains(repos, e.Repo) {
+			repos = append(repos, e.Repo)
+		}
+	}
+	return repos
+}
+
+// recordTriage appends a local triage action to this device's log and marks
+// it as the latest known state for the PR.
+func recordTriage(action, repo string, number int) {
+	if !syncEnabled() {
+		return
+	}
+
+	e := triageEvent{
+		Time:   clock.Now().UTC(),
+		Device: syncDevice,
+		Action: action,
+		Repo:   repo,
+		Number: number,
+	}
+
+	if err := store.SaveTriageState(e); err != nil {
+		syncLog().Warn("Failed to record triage state", prAttr(repo, number), "err", err)
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		syncLog().Warn("Failed to encode triage event", "err", err)
+		return
+	}
+
+	f, err := os.OpenFile(syncLogPath(syncDevice), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		syncLog().Warn("Failed to open triage log", "err", err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		syncLog().Warn("Failed to write triage log", "err", err)
+	}
+}
+
+// syncTriage reads new entries from every device log in the sync directory
+// and applies those that win last-writer-wins. Returns the events applied.
+func syncTriage() ([]triageEvent, error) {
+	paths, err := filepath.Glob(filepath.Join(config.Sync.Dir, "*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []triageEvent
+	for _, path := range paths {
+		events, err := syncTriageFile(path)
+		applied = append(applied, events...)
+		if err != nil {
+			return applied, fmt.Errorf("%s: %w", filepath.Base(path), err)
+		}
+	}
+	return applied, nil
+}
+
+func syncTriageFile(path string) ([]triageEvent, error) {
+	offsetKey := "sync_offset:" + filepath.Base(path)
+	offset, _ := strconv.ParseInt(store.GetState(offsetKey), 10, 64)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < offset {
+		// The log was truncated or replaced; replaying is safe since events are idempotent
+		offset = 0
+	}
+	if info.Size() == offset {
+		return nil, nil
+	}
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only consume complete lines; a partial trailing line may still be syncing
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		return nil, nil
+	}
+	data = data[:end+1]
+
+	var applied []triageEvent
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var e triageEvent
+		if err := json.Unmarshal(line, &e); err != nil {
+			syncLog().Warn("Skipping malformed triage event", "file", filepath.Base(path), "err", err)
+			continue
+		}
+		ok, err := store.ApplyTriageEvent(e)
+		if err != nil {
+			return applied, err
+		}
+		if ok {
+			applied = append(applied, e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return applied, err
+	}
+
+	return applied, store.SetState(offsetKey, strconv.FormatInt(offset+int64(len(data)), 10))
+}
+
+// ApplyTriageEvent applies e if it is newer than the state we already hold for
+// that PR and flag. The comparison and both writes share a transaction, so
+// nothing can update triage_state between the check and the write.
+func (s *sqliteStore) ApplyTriageEvent(e triageEvent) (bool, error) {
+	column, value, ok := e.field()
+	if !ok || e.Repo == "" || e.Number <= 0 {
+		return false, nil
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var updatedAt, device string
+	err = tx.QueryRow(
+		"SELECT updated_at, device FROM triage_state WHERE repo = ? AND number = ? AND field = ?",
+		e.Repo, e.Number, column,
+	).Scan(&updatedAt, &device)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return false, err
+	default:
+		t, _ := time.Parse(time.RFC3339Nano, updatedAt)
+		if !e.newerThan(t, device) {
+			return false, nil
+		}
+	}
+
+	if column == "ignored" {
+		err = setIgnored(tx, e.Repo, e.Number, value)
+	} else {
+		err = setMuted(tx, e.Repo, e.Number, value)
+	}
+	if err == nil && !value {
+		err = dropPlaceholder(tx, e.Repo, e.Number)
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := saveTriageState(tx, e); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+func (s *sqliteStore) SaveTriageState(e triageEvent) error {
+	return saveTriageState(s.db, e)
+}
+
+func saveTriageState(ex dbExecer, e triageEvent) error {
+	column, value, ok := e.field()
+	if !ok {
+		return fmt.Errorf("unknown triage action %q", e.Action)
+	}
+	_, err := ex.Exec(`
+		INSERT INTO triage_state (repo, number, field, value, updated_at, device)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (repo, number, field) DO UPDATE SET
+			value = excluded.value,
+			updated_at = excluded.updated_at,
+			device = excluded.device
+	`, e.Repo, e.Number, column, boolToInt(value), e.Time.UTC().Format(time.RFC3339Nano), e.Device)
+	return err
+}
+
+func syncLogPath(device string) string {
+	return filepath.Join(config.Sync.Dir, device+".jsonl")
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+// writeDeviceLog replaces device's log in the sync dir with events.
+func writeDeviceLog(t *testing.T, device string, events ...triageEvent) {
+	t.Helper()
+	var data []byte
+	for _, e := range events {
+		e.Device = device
+		line, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data = append(append(data, line...), '\n')
+	}
+	if err := os.WriteFile(syncLogPath(device), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func setupSync(t *testing.T) *fakeClock {
+	t.Helper()
+	_, clk := setupTest(t)
+	config.Sync.Dir = t.TempDir()
+	oldDevice := syncDevice
+	syncDevice = "laptop"
+	t.Cleanup(func() { syncDevice = oldDevice })
+	return clk
+}
+
+func TestSyncLastWriterWins(t *testing.T) {
+	setupSync(t)
+	store.IgnorePR("acme/api", 7)
+	store.MutePR("acme/api", 8)
+
+	writeDeviceLog(t, "desktop",
+		triageEvent{Time: testNow.Add(time.Minute), Action: triageUnignore, Repo: "acme/api", Number: 7},
+		triageEvent{Time: testNow.Add(-time.Minute), Action: triageUnmute, Repo: "acme/api", Number: 8},
+	)
+	if _, err := syncTriage(); err != nil {
+		t.Fatal(err)
+	}
+	if store.IsIgnored("acme/api", 7) {
+		t.Error("desktop's later unignore should win over this device's ignore")
+	}
+	if !store.IsMuted("acme/api", 8) {
+		t.Error("desktop's earlier unmute shouldn't undo this device's later mute")
+	}
+
+	// This device's log is replayed too, without undoing what desktop won
+	if applied, err := syncTriage(); err != nil || len(applied) != 0 {
+		t.Errorf("second sync applied %d, %v; want nothing new", len(applied), err)
+	}
+	if store.IsIgnored("acme/api", 7) {
+		t.Error("replaying this device's own log brought back the ignore")
+	}
+}
+
+func TestSyncRereadsTruncatedLog(t *testing.T) {
+	setupSync(t)
+	store.MutePR("acme/api", 8)
+
+	writeDeviceLog(t, "desktop",
+		triageEvent{Time: testNow.Add(-2 * time.Minute), Action: triageIgnore, Repo: "acme/api", Number: 9},
+		triageEvent{Time: testNow.Add(-time.Minute), Action: triageUnignore, Repo: "acme/api", Number: 9},
+	)
+	if applied, err := syncTriage(); err != nil || len(applied) != 2 {
+		t.Fatalf("first sync applied %d, %v; want 2", len(applied), err)
+	}
+
+	// The log is replaced by a shorter one, e.g. restored from elsewhere;
+	// reading on from the old offset would skip it
+	writeDeviceLog(t, "desktop",
+		triageEvent{Time: testNow.Add(time.Minute), Action: triageUnmute, Repo: "acme/api", Number: 8},
+	)
+	if applied, err := syncTriage(); err != nil || len(applied) != 1 {
+		t.Fatalf("sync after truncation applied %d, %v; want 1", len(applied), err)
+	}
+	if store.IsMuted("acme/api", 8) {
+		t.Error("the unmute in the rewritten log wasn't applied")
+	}
+}
+
+func TestSyncWaitsForCompleteLines(t *testing.T) {
+	setupSync(t)
+	line, _ := json.Marshal(triageEvent{Time: testNow, Device: "desktop", Action: triageIgnore, Repo: "acme/api", Number: 7})
+
+	os.WriteFile(syncLogPath("desktop"), line[:10], 0644)
+	if applied, err := syncTriage(); err != nil || len(applied) != 0 {
+		t.Fatalf("partial line: applied %d, %v; want nothing yet", len(applied), err)
+	}
+	os.WriteFile(syncLogPath("desktop"), append(line, '\n'), 0644)
+	if applied, err := syncTriage(); err != nil || len(applied) != 1 || !store.IsIgnored("acme/api", 7) {
+		t.Errorf("complete line: applied %d, %v; want the ignore", len(applied), err)
+	}
+}
+
+func TestSyncIgnoreThenUnignoreLeavesNoBlankPR(t *testing.T) {
+	setupSync(t)
+	writeDeviceLog(t, "desktop",
+		triageEvent{Time: testNow.Add(-2 * time.Minute), Action: triageIgnore, Repo: "acme/api", Number: 9},
+		triageEvent{Time: testNow.Add(-time.Minute), Action: triageMute, Repo: "other/repo", Number: 3},
+	)
+	if _, err := syncTriage(); err != nil {
+		t.Fatal(err)
+	}
+
+	// e.g. Clear Ignored on the desktop
+	writeDeviceLog(t, "desktop",
+		triageEvent{Time: testNow.Add(-2 * time.Minute), Action: triageIgnore, Repo: "acme/api", Number: 9},
+		triageEvent{Time: testNow.Add(-time.Minute), Action: triageMute, Repo: "other/repo", Number: 3},
+		triageEvent{Time: testNow, Action: triageUnignore, Repo: "acme/api", Number: 9},
+		triageEvent{Time: testNow, Action: triageUnmute, Repo: "other/repo", Number: 3},
+	)
+	applied, err := syncTriage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if active, _ := store.LoadActivePRs(); len(active) != 0 {
+		t.Errorf("active PRs = %+v, want no blank placeholders", active)
+	}
+	if repos := clearedRepos(applied); len(repos) != 1 || repos[0] != "acme/api" {
+		t.Errorf("repos to refresh = %v, want just the monitored acme/api", repos)
+	}
+}
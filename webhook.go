@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// The webhook receiver lets GitHub push pull_request, pull_request_review and
+// pull_request_review_comment events to the monitor. Each event is reduced to
+// a repo and PR number and fed through processPRUpdate, the same path used
+// for notifications.
+
+const defaultWebhookPath = "/webhook"
+
+// maxWebhookPayload is GitHub's own cap on delivery size.
+const maxWebhookPayload = 25 << 20
+
+type WebhookConfig struct {
+	Listen string `yaml:"listen"`
+	Path   string `yaml:"path"`
+	Secret string `yaml:"secret"`
+}
+
+func webhookEnabled() bool {
+	return config.Webhook.Listen != ""
+}
+
+func webhookPath() string {
+	if config.Webhook.Path != "" {
+		return config.Webhook.Path
+	}
+	return defaultWebhookPath
+}
+
+func handleWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// ValidatePayload falls back to the legacy SHA-1 header; only accept SHA-256
+	if r.Header.Get(github.SHA256SignatureHeader) == "" {
+		http.Error(w, "missing "+github.SHA256SignatureHeader, http.StatusUnauthorized)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxWebhookPayload)
+	payload, err := github.ValidatePayload(r, []byte(config.Webhook.Secret))
+	if tooLarge := (*http.MaxBytesError)(nil); errors.As(err, &tooLarge) {
+		http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		webhookLog().Warn("Rejected webhook delivery", "delivery", github.DeliveryID(r), "err", err)
+		http.Error(w, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	eventType := github.WebHookType(r)
+	if eventType == "ping" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	event, err := github.ParseWebHook(eventType, payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repo, number, reason, ok := webhookPRRef(event)
+	if !ok || !makeRepoSet()[repo] {
+		// Valid, but nothing we track
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	webhookLog().Info("Webhook received", "event", eventType, prAttr(repo, number))
+	w.WriteHeader(http.StatusAccepted)
+
+	// Don't hold GitHub's delivery open while we call back into the API
+	goBackground(func() {
+		if processPRUpdate(appCtx, repo, number, reason) {
+			reloadPRsFromDB()
+		}
+	})
+}
+
+// webhookPRRef extracts the PR an event refers to and the notification reason
+// it corresponds to, so follow-up and reason handling behave as for notifications.
+func webhookPRRef(event any) (repo string, number int, reason string, ok bool) {
+	switch e := event.(type) {
+	case *github.PullRequestEvent:
+		// Requests for other reviewers say nothing about why the PR is on
+		// your list; team requests might be for one of your teams
+		if e.GetAction() == "review_requested" && (e.GetRequestedReviewer().GetLogin() == currentUser || e.GetRequestedTeam() != nil) {
+			reason = "review_requested"
+		}
+		return e.GetRepo().GetFullName(), e.GetPullRequest().GetNumber(), reason, true
+	case *github.PullRequestReviewEvent:
+		return e.GetRepo().GetFullName(), e.GetPullRequest().GetNumber(), "comment", true
+	case *github.PullRequestReviewCommentEvent:
+		return e.GetRepo().GetFullName(), e.GetPullRequest().GetNumber(), "comment", true
+	}
+	return "", 0, "", false
+}
+
+// runWebhookReplay posts saved webhook payloads to the running listener, signed
+// with the configured secret, so deliveries can be replayed or tested locally.
+func runWebhookReplay(args []string) error {
+	fs := flag.NewFlagSet("webhook-replay", flag.ContinueOnError)
+	eventType := fs.String("event", "", "GitHub event `type` of the payloads (pull_request, pull_request_review, pull_request_review_comment)")
+	target := fs.String("url", "", "listener `URL` (default: derived from webhook.listen in config)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *eventType == "" || fs.NArg() == 0 {
+		return fmt.Errorf("usage: pr-monitor webhook-replay -event TYPE payload.json...")
+	}
+
+	if err := loadConfig(); err != nil {
+		return err
+	}
+	if !webhookEnabled() {
+		return fmt.Errorf("webhook.listen is not configured")
+	}
+
+	url := *target
+	if url == "" {
+		url = webhookURL()
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	for i, path := range fs.Args() {
+		payload, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(github.EventTypeHeader, *eventType)
+		req.Header.Set(github.DeliveryIDHeader, fmt.Sprintf("replay-%d-%d", time.Now().Unix(), i))
+		req.Header.Set(github.SHA256SignatureHeader, signWebhookPayload(payload, config.Webhook.Secret))
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		fmt.Printf("%s: %s %s\n", filepath.Base(path), resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func signWebhookPayload(payload []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookURL turns the listen address into a URL reachable from this machine.
+func webhookURL() string {
+	host, port, err := net.SplitHostPort(config.Webhook.Listen)
+	if err != nil {
+		return "http://" + config.Webhook.Listen + webhookPath()
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "127.0.0.1"
+	}
+	return "http://" + net.JoinHostPort(host, port) + webhookPath()
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/go-github/v57/github"
+)
+
+// deliverWebhook posts event to handleWebhook, signed with sig unless it's
+// empty, and waits for any update it kicks off.
+func deliverWebhook(t *testing.T, eventType string, event any, sig func(payload []byte) string) int {
+	t.Helper()
+	payload, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, defaultWebhookPath, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(github.EventTypeHeader, eventType)
+	if sig != nil {
+		req.Header.Set(github.SHA256SignatureHeader, sig(payload))
+	}
+	rec := httptest.NewRecorder()
+	handleWebhook(rec, req)
+	background.Wait()
+	return rec.Code
+}
+
+func signedWith(secret string) func([]byte) string {
+	return func(payload []byte) string { return signWebhookPayload(payload, secret) }
+}
+
+func prEvent(action string, number int) *github.PullRequestEvent {
+	return &github.PullRequestEvent{
+		Action:      github.String(action),
+		Repo:        &github.Repository{FullName: github.String("acme/api")},
+		PullRequest: &github.PullRequest{Number: github.Int(number)},
+	}
+}
+
+func TestWebhookUpdatesPR(t *testing.T) {
+	gh, _ := setupTest(t)
+	config.Webhook.Secret = "s3cret"
+	gh.addPR(7, "alice", requested("me"))
+
+	if code := deliverWebhook(t, "pull_request", prEvent("opened", 7), signedWith("s3cret")); code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202", code)
+	}
+	if got := prNumbers(t); len(got) != 1 || got[0] != 7 {
+		t.Errorf("listed PRs = %v, want [7]", got)
+	}
+}
+
+func TestWebhookRejectsUnsignedDeliveries(t *testing.T) {
+	gh, _ := setupTest(t)
+	config.Webhook.Secret = "s3cret"
+	gh.addPR(7, "alice", requested("me"))
+
+	for name, sig := range map[string]func([]byte) string{
+		"missing signature": nil,
+		"wrong secret":      signedWith("guess"),
+	} {
+		if code := deliverWebhook(t, "pull_request", prEvent("opened", 7), sig); code != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want 401", name, code)
+		}
+	}
+	if n := gh.requestCount("GET", "/repos/acme/api/pulls/7"); n != 0 {
+		t.Errorf("fetched the PR %d times for rejected deliveries", n)
+	}
+	if got := prNumbers(t); len(got) != 0 {
+		t.Errorf("listed PRs = %v, want none", got)
+	}
+}
+
+func TestWebhookReviewRequestedFromSomeoneElse(t *testing.T) {
+	gh, _ := setupTest(t)
+	config.Webhook.Secret = "s3cret"
+	gh.addPR(7, "alice", requested("bob"))
+	store.SavePR(PRInfo{Repo: "acme/api", Number: 7, Author: "alice", NeedsReview: true, Reason: reasonMention})
+
+	event := prEvent("review_requested", 7)
+	event.RequestedReviewer = &github.User{Login: github.String("bob")}
+	if code := deliverWebhook(t, "pull_request", event, signedWith("s3cret")); code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202", code)
+	}
+	if got := store.PRReason("acme/api", 7); got != reasonMention {
+		t.Errorf("reason = %q, want %q kept; bob's review request isn't about me", got, reasonMention)
+	}
+
+	// A request for one of my teams does change it
+	event.RequestedReviewer = nil
+	event.RequestedTeam = &github.Team{Slug: github.String("backend")}
+	deliverWebhook(t, "pull_request", event, signedWith("s3cret"))
+	if got := store.PRReason("acme/api", 7); got != reasonTeam {
+		t.Errorf("reason after a team request = %q, want %q", got, reasonTeam)
+	}
+}